@@ -1,48 +0,0 @@
-package clustertransport
-
-import (
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"time"
-
-	elastic "gopkg.in/olivere/elastic.v3"
-)
-
-// ElasticsearchCluster implements for ClusterBase interface.
-type ElasticsearchCluster struct{}
-
-// Sniff method returns node connection strings.
-func (m *ElasticsearchCluster) Sniff(conn *Conn) []string {
-	resp, err := http.Get(conn.URI + "/_nodes/http")
-	if err != nil {
-		return []string{}
-	}
-	defer resp.Body.Close()
-
-	var uris []string
-	var info *elastic.NodesInfoResponse
-
-	if err := json.NewDecoder(resp.Body).Decode(&info); err == nil {
-		if len(info.Nodes) > 0 {
-			for _, node := range info.Nodes {
-				if node.HTTPAddress != "" {
-					uris = append(uris, fmt.Sprintf("http://%s", node.HTTPAddress))
-				}
-			}
-		}
-	}
-
-	return uris
-}
-
-// Conn method returns one of cluster system connection.
-func (m *ElasticsearchCluster) Conn(uri string) (*Conn, error) {
-	var options []elastic.ClientOptionFunc
-	options = append(options, elastic.SetHttpClient(&http.Client{Timeout: 5 * time.Second}))
-	options = append(options, elastic.SetURL(uri))
-	options = append(options, elastic.SetSniff(false))
-
-	client, err := elastic.NewClient(options...)
-	return &Conn{Client: client}, err
-}
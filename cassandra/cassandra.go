@@ -0,0 +1,158 @@
+// Package cassandra implements ClusterBase interface for Cassandra and
+// ScyllaDB, which discovers peers from `system.local` and `system.peers`
+// tables via user-supplied query function, and labels connections with
+// datacenter and rack for datacenter-local routing.
+package cassandra
+
+import (
+	"context"
+	"sync"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// Statements which are passed to Query.
+const (
+	LocalQuery = "SELECT broadcast_address, rpc_address, data_center, rack, host_id FROM system.local"
+	PeersQuery = "SELECT peer, rpc_address, data_center, rack, host_id FROM system.peers"
+)
+
+// Row is one of row which is returned by Query, that's keyed by column name.
+// Values are able to be string, []byte, net.IP, fmt.Stringer and so on.
+type Row map[string]interface{}
+
+// Query runs stmt on the node of conn, and then returns rows.
+type Query func(ctx context.Context, conn *ctbase.Conn, stmt string) ([]Row, error)
+
+// DCLocal returns a selector which sends requests to nodes in datacenter dc,
+// and to remote datacenters only when there's no alive node in dc.
+func DCLocal(dc string) *ctbase.LabelSelector {
+	return &ctbase.LabelSelector{Key: "dc", Value: dc}
+}
+
+// New returns Cluster which discovers peers via query, and builds clients via newClient.
+func New(query Query, newClient func(uri string) (interface{}, error)) *Cluster {
+	return &Cluster{Query: query, NewClient: newClient, Port: 9042}
+}
+
+// Cluster implements ClusterBase and LabelBase interfaces for Cassandra and ScyllaDB.
+type Cluster struct {
+	Query     Query
+	NewClient func(uri string) (interface{}, error)
+	Port      int    // Default: 9042
+	LocalDC   string // Default: Nodes in all of datacenters are discovered
+
+	mu    sync.RWMutex
+	peers map[string]Peer
+}
+
+// Sniff method returns node connection strings.
+func (c *Cluster) Sniff(conn *ctbase.Conn) []string {
+	return c.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method returns uris of the node and its peers.
+func (c *Cluster) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	peers, err := c.Peers(ctx, conn)
+	if err != nil {
+		return []string{}
+	}
+
+	found := make(map[string]Peer, len(peers))
+	uris := []string{}
+
+	for _, p := range peers {
+		if c.LocalDC != "" && p.DataCenter != c.LocalDC {
+			continue
+		}
+
+		uri := p.URI(c.port())
+		if _, ok := found[uri]; ok {
+			continue
+		}
+
+		found[uri] = p
+		uris = append(uris, uri)
+	}
+
+	c.mu.Lock()
+	c.peers = found
+	c.mu.Unlock()
+
+	return uris
+}
+
+// Peers returns the node of conn and its peers.
+func (c *Cluster) Peers(ctx context.Context, conn *ctbase.Conn) ([]Peer, error) {
+	if c.Query == nil {
+		return nil, errors.New("Query isn't configured")
+	}
+
+	local, err := c.Query(ctx, conn, LocalQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to query system.local")
+	}
+	rows, err := c.Query(ctx, conn, PeersQuery)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to query system.peers")
+	}
+
+	var peers []Peer
+	for _, row := range local {
+		if p, ok := parseRow(row, "broadcast_address"); ok {
+			peers = append(peers, p)
+		}
+	}
+	for _, row := range rows {
+		if p, ok := parseRow(row, "peer"); ok {
+			peers = append(peers, p)
+		}
+	}
+
+	return peers, nil
+}
+
+// Conn method returns one of cluster system connection.
+func (c *Cluster) Conn(uri string) (*ctbase.Conn, error) {
+	return c.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection which is
+// labeled by datacenter and rack.
+func (c *Cluster) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn := &ctbase.Conn{Labels: c.Labels(uri)}
+	if c.NewClient != nil {
+		client, err := c.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build client")
+		}
+		conn.Client = client
+	}
+
+	return conn, nil
+}
+
+// Labels method returns datacenter, rack and host id of the node.
+func (c *Cluster) Labels(uri string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	p, ok := c.peers[uri]
+	if !ok {
+		return nil
+	}
+
+	return map[string]string{"dc": p.DataCenter, "rack": p.Rack, "host_id": p.HostID}
+}
+
+func (c *Cluster) port() int {
+	if c.Port <= 0 {
+		return 9042
+	}
+	return c.Port
+}
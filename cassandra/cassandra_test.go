@@ -0,0 +1,108 @@
+package cassandra
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+type uuid string
+
+func (u uuid) String() string { return string(u) }
+
+func fakeQuery(local, peers []Row) Query {
+	return func(ctx context.Context, conn *ctbase.Conn, stmt string) ([]Row, error) {
+		switch stmt {
+		case LocalQuery:
+			return local, nil
+		case PeersQuery:
+			return peers, nil
+		}
+		return nil, errors.New("unknown statement")
+	}
+}
+
+var (
+	localRows = []Row{
+		{"broadcast_address": net.ParseIP("10.0.0.1"), "rpc_address": net.ParseIP("0.0.0.0"),
+			"data_center": "dc1", "rack": "r1", "host_id": uuid("a1")},
+	}
+	peerRows = []Row{
+		{"peer": net.ParseIP("10.0.0.2"), "rpc_address": []byte{10, 1, 0, 2},
+			"data_center": "dc1", "rack": "r2", "host_id": uuid("a2")},
+		{"peer": "10.0.1.1", "rpc_address": nil, "data_center": "dc2", "rack": "r1", "host_id": "b1"},
+		{"peer": nil, "rpc_address": nil, "data_center": "dc2"},
+	}
+)
+
+func TestSniff(t *testing.T) {
+	c := New(fakeQuery(localRows, peerRows), nil)
+
+	uris := c.Sniff(&ctbase.Conn{URI: "10.0.0.1:9042"})
+	assert.Equal(t, []string{"10.0.0.1:9042", "10.1.0.2:9042", "10.0.1.1:9042"}, uris)
+
+	conn, err := c.Conn("10.1.0.2:9042")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"dc": "dc1", "rack": "r2", "host_id": "a2"}, conn.Labels)
+	assert.Equal(t, "dc2", c.Labels("10.0.1.1:9042")["dc"])
+
+	c.LocalDC = "dc2"
+	c.Port = 19042
+	assert.Equal(t, []string{"10.0.1.1:19042"}, c.Sniff(&ctbase.Conn{}))
+	assert.Nil(t, c.Labels("10.0.0.1:9042"))
+}
+
+func TestParseRow(t *testing.T) {
+	id := []byte{0x55, 0x0e, 0x84, 0x00, 0xe2, 0x9b, 0x41, 0xd4, 0xa7, 0x16, 0x44, 0x66, 0x55, 0x44, 0x00, 0x00}
+	ip := net.ParseIP("fd00::1").To16()
+
+	p, ok := parseRow(Row{"peer": ip, "rpc_address": []byte(ip), "data_center": []byte("dc1"), "host_id": id}, "peer")
+	assert.True(t, ok)
+	assert.Equal(t, Peer{Address: "fd00::1", DataCenter: "dc1", HostID: "550e8400-e29b-41d4-a716-446655440000"}, p)
+}
+
+func TestSniffFailure(t *testing.T) {
+	c := New(func(ctx context.Context, conn *ctbase.Conn, stmt string) ([]Row, error) {
+		return nil, errors.New("unavailable")
+	}, nil)
+	assert.Empty(t, c.Sniff(&ctbase.Conn{}))
+
+	c = New(nil, nil)
+	assert.Empty(t, c.Sniff(&ctbase.Conn{}))
+}
+
+func TestDCLocal(t *testing.T) {
+	c := New(fakeQuery(localRows, peerRows), func(uri string) (interface{}, error) { return uri, nil })
+
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = c
+	cfg.Selector = DCLocal("dc2")
+	ts := ctbase.NewTransport(cfg, "10.0.0.1:9042")
+	assert.NoError(t, ts.Discover(context.Background()))
+
+	for i := 0; i < 5; i++ {
+		uri, err := ts.Req(func(conn *ctbase.Conn) (interface{}, error) { return conn.Client, nil })
+		assert.NoError(t, err)
+		assert.Equal(t, "10.0.1.1:9042", uri)
+	}
+
+	// Requests fallback to remote datacenter when local nodes are dead.
+	ts.Req(func(conn *ctbase.Conn) (interface{}, error) {
+		if conn.Labels["dc"] == "dc2" {
+			return nil, &ctbase.Econnrefused{}
+		}
+		return nil, nil
+	})
+
+	for i := 0; i < 4; i++ {
+		_, err := ts.Req(func(conn *ctbase.Conn) (interface{}, error) {
+			assert.Equal(t, "dc1", conn.Labels["dc"])
+			return nil, nil
+		})
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,80 @@
+package cassandra
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Peer is one of node which is read from system tables.
+type Peer struct {
+	Address    string
+	DataCenter string
+	Rack       string
+	HostID     string
+}
+
+// URI returns host:port for native protocol.
+func (p Peer) URI(port int) string {
+	return net.JoinHostPort(p.Address, strconv.Itoa(port))
+}
+
+// parseRow reads a peer from row. rpc_address is used as the address, and
+// then fallback is used when it's unset or wildcard, as drivers do.
+func parseRow(row Row, fallback string) (Peer, bool) {
+	addr := toAddress(row["rpc_address"])
+	if ip := net.ParseIP(addr); addr == "" || (ip != nil && ip.IsUnspecified()) {
+		addr = toAddress(row[fallback])
+	}
+	if addr == "" {
+		return Peer{}, false
+	}
+
+	return Peer{
+		Address:    addr,
+		DataCenter: toString(row["data_center"]),
+		Rack:       toString(row["rack"]),
+		HostID:     toUUID(row["host_id"]),
+	}, true
+}
+
+// toAddress reads inet columns, which driver returns as raw 4 or 16 bytes.
+func toAddress(v interface{}) string {
+	if b, ok := v.([]byte); ok && (len(b) == net.IPv4len || len(b) == net.IPv6len) {
+		return net.IP(b).String()
+	}
+	return toString(v)
+}
+
+// toUUID reads uuid columns, which driver returns as raw 16 bytes.
+func toUUID(v interface{}) string {
+	if b, ok := v.([]byte); ok && len(b) == 16 {
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+	}
+	return toString(v)
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *string:
+		if v == nil {
+			return ""
+		}
+		return *v
+	case net.IP:
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
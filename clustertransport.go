@@ -1,19 +1,82 @@
 package clustertransport
 
+import (
+	"context"
+	"log/slog"
+)
+
 // ClusterBase has interfaces which connects Cluster System.
 type ClusterBase interface {
 	Sniff(conn *Conn) []string
 	Conn(uri string) (*Conn, error)
 }
 
+// ClusterContextBase is ClusterBase which is able to be canceled. Sniffer
+// calls these instead of ClusterBase's methods, with SniffTimeout and DialTimeout.
+type ClusterContextBase interface {
+	ClusterBase
+	SniffContext(ctx context.Context, conn *Conn) []string
+	ConnContext(ctx context.Context, uri string) (*Conn, error)
+}
+
+// LabelBase is ClusterBase which labels connections. Labels are refreshed by
+// every discovery, even if connections are reused.
+type LabelBase interface {
+	Labels(uri string) map[string]string
+}
+
+// WeightBase is ClusterBase which weights connections. Weights are refreshed
+// by every discovery, even if connections are reused.
+type WeightBase interface {
+	Weight(uri string) int
+}
+
 // SelectorBase has a interface which selects cluster connections.
 type SelectorBase interface {
 	Select(conns []*Conn) *Conn
 }
 
+// KeySelectorBase is SelectorBase which selects a connection by key, such as
+// the owner of key's hash slot. Select is used when SelectKey returns nil.
+type KeySelectorBase interface {
+	SelectorBase
+	SelectKey(conns []*Conn, key string) *Conn
+}
+
+// DiscoveryWatcher has a interface which streams membership changes of
+// cluster system, such as service registry's watch.
+type DiscoveryWatcher interface {
+	Watch(ctx context.Context, events chan<- NodeEvent) error
+}
+
+// NodeEventType is a kind of membership change.
+type NodeEventType int
+
+const (
+	// NodesSet replaces all of nodes.
+	NodesSet NodeEventType = iota
+	// NodeAdded adds nodes.
+	NodeAdded
+	// NodeRemoved removes nodes.
+	NodeRemoved
+)
+
+// NodeEvent notices membership change to Cluster Transport.
+type NodeEvent struct {
+	Type NodeEventType
+	URIs []string
+}
+
 // Econnrefused notices dead connection to Cluseter Transport.
 type Econnrefused struct {
-	s string
+	s   string
+	err error
+}
+
+// NewEconnrefused returns Econnrefused which wraps err, so that Transport
+// handles err as a connection error.
+func NewEconnrefused(err error) *Econnrefused {
+	return &Econnrefused{s: err.Error(), err: err}
 }
 
 // Error returns Econnrefused's error message.
@@ -21,20 +84,52 @@ func (e *Econnrefused) Error() string {
 	return e.s
 }
 
+// Unwrap returns the error which caused dead connection.
+func (e *Econnrefused) Unwrap() error {
+	return e.err
+}
+
+// Redirect notices Cluster Transport to retry the request on the node, such
+// as a node that's pointed by MOVED and ASK errors of Redis Cluster.
+type Redirect struct {
+	URI string
+	Err error
+}
+
+// Error returns Redirect's error message.
+func (e *Redirect) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error which caused redirection.
+func (e *Redirect) Unwrap() error {
+	return e.Err
+}
+
 // Config is
 type Config struct {
 	Cluster  ClusterBase
 	Selector SelectorBase
 
-	Logger func(format string, params ...interface{})
+	Logger  func(format string, params ...interface{})
+	Slog    *slog.Logger // Default: Logs into Logger at all of levels
+	Metrics MetricsSink  // Default: Records nothing
+	Tracer  Tracer       // Default: Traces nothing
 
-	Discover       bool  // Default: true,
-	DiscoverTick   int   // Default: Discovers nodes per 120 sec
-	DiscoverAfter  int64 // Default: Discovers nodes after passed 10,000 requests
-	RetryOnFailure bool  // Default: Retrying asap when one of connection failed
-	ResurrectAfter int64 // Default: Tries to resurrect some of connections when Cluster Transport hasn't request to cluster system until it passed 30 sec.
-	MaxRetries     int   // Default: Tries to retry's number for http request
-	Debug          bool
+	Discover          bool    // Default: true,
+	DiscoverTick      int     // Default: Discovers nodes per 120 sec
+	DiscoverAfter     int64   // Default: Discovers nodes after passed 10,000 requests
+	DiscoverOnFailure bool    // Default: Discovers nodes asap when one of connection is marked dead
+	DiscoverRatio     float64 // Default: Discovers nodes when alive connections dropped below 50%, which is a fallback used only without DiscoverOnFailure
+	DiscoverInterval  int     // Default: Discovers nodes on failures at most once per 5 sec
+	SniffTick         int     // Default: Sniffs cluster system per 60 sec
+	SniffTimeout      int     // Default: Gives up sniffing cluster system after 5 sec
+	DialTimeout       int     // Default: Gives up connection establishment to a node after 5 sec
+	RetryOnFailure    bool    // Default: Retrying asap when one of connection failed
+	ResurrectAfter    int64   // Default: Tries to resurrect some of connections when Cluster Transport hasn't request to cluster system until it passed 30 sec.
+	MaxRetries        int     // Default: Tries to retry's number for http request
+	Debug             bool
+	DebugTick         int // Default: Prints debug information per 5 sec
 }
 
 // PrintNothing does nothing.
@@ -43,13 +138,20 @@ func PrintNothing(format string, v ...interface{}) {}
 // NewConfig returns a Config struct which has some of field for handling Cluster Transport.
 func NewConfig() *Config {
 	return &Config{
-		Selector:       &RoundRobinSelector{},
-		Logger:         PrintNothing,
-		Discover:       true,
-		DiscoverTick:   120,
-		DiscoverAfter:  100000,
-		RetryOnFailure: false,
-		ResurrectAfter: 30,
-		MaxRetries:     5,
+		Selector:          &RoundRobinSelector{},
+		Logger:            PrintNothing,
+		Discover:          true,
+		DiscoverTick:      120,
+		DiscoverAfter:     100000,
+		DiscoverOnFailure: true,
+		DiscoverRatio:     0.5,
+		DiscoverInterval:  5,
+		SniffTick:         60,
+		SniffTimeout:      5,
+		DialTimeout:       5,
+		RetryOnFailure:    false,
+		ResurrectAfter:    30,
+		MaxRetries:        5,
+		DebugTick:         5,
 	}
 }
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+)
+
+// Fault injects failures into requests to a node.
+type Fault struct {
+	URI   string
+	After time.Duration // Starts failing after the duration since the beginning
+	Rate  float64       // Rate of failed requests, which is 1 when it's zero
+}
+
+// ParseFault parses "uri", "uri@after" or "uri@after:rate", such as "10.0.0.1:11211@5s:0.5".
+func ParseFault(s string) (Fault, error) {
+	f := Fault{URI: s, Rate: 1}
+
+	i := strings.LastIndex(s, "@")
+	if i < 0 {
+		return f, nil
+	}
+	f.URI = s[:i]
+
+	spec := s[i+1:]
+	if j := strings.Index(spec, ":"); j >= 0 {
+		if _, err := fmt.Sscanf(spec[j+1:], "%g", &f.Rate); err != nil || f.Rate < 0 || f.Rate > 1 {
+			return f, fmt.Errorf("invalid fault rate %q", spec[j+1:])
+		}
+		spec = spec[:j]
+	}
+
+	var err error
+	if f.After, err = time.ParseDuration(spec); err != nil {
+		return f, fmt.Errorf("invalid fault %q: %s", s, err)
+	}
+	return f, nil
+}
+
+// ParseSelector returns a selector by name: roundrobin, random, weighted or
+// label:key=value.
+func ParseSelector(name string) (ctbase.SelectorBase, error) {
+	switch {
+	case name == "roundrobin":
+		return &ctbase.RoundRobinSelector{}, nil
+	case name == "random":
+		return &ctbase.RandomSelector{}, nil
+	case name == "weighted":
+		return &ctbase.WeightedRandomSelector{}, nil
+	case strings.HasPrefix(name, "label:"):
+		kv := strings.SplitN(strings.TrimPrefix(name, "label:"), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label selector %q", name)
+		}
+		return &ctbase.LabelSelector{Key: kv[0], Value: kv[1]}, nil
+	}
+
+	return nil, fmt.Errorf("unknown selector %q", name)
+}
+
+// Bench drives concurrent workloads through Transport.
+type Bench struct {
+	Transport   *ctbase.Transport
+	Concurrency int
+	Duration    time.Duration
+	Requests    int    // Stops after the requests when it's positive
+	Op          string // "noop" selects a node only, "dial" dials the node by TCP
+	DialTimeout time.Duration
+	Faults      []Fault
+
+	// Retries of a request as Transport does with Config.MaxRetries and
+	// Config.RetryOnFailure, since workloads are run outside of Transport.
+	MaxRetries     int
+	RetryOnFailure bool
+}
+
+// Result is a result of Bench.
+type Result struct {
+	Requests  int64
+	Errors    int64
+	Retries   int64 // Attempts which were sent in addition to the first one
+	Elapsed   time.Duration
+	Latencies []time.Duration  // Sorted
+	Nodes     map[string]int64 // Succeeded requests per node
+	Failed    map[string]int64 // Failed attempts per node
+}
+
+// Run runs workloads until Duration passes or Requests are done.
+func (b *Bench) Run() *Result {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		issued  int64
+		retries int64
+		errs    int64
+	)
+
+	r := &Result{Nodes: map[string]int64{}, Failed: map[string]int64{}}
+	start := time.Now()
+	deadline := start.Add(b.Duration)
+
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+
+			rnd := rand.New(rand.NewSource(seed))
+			var latencies []time.Duration
+
+			for {
+				if b.Requests > 0 {
+					if atomic.AddInt64(&issued, 1) > int64(b.Requests) {
+						break
+					}
+				} else if time.Now().After(deadline) {
+					break
+				}
+
+				began := time.Now()
+				uri, attempts, err := b.request(time.Since(start), rnd, func(uri string) {
+					mu.Lock()
+					r.Failed[uri]++
+					mu.Unlock()
+				})
+				latencies = append(latencies, time.Since(began))
+
+				atomic.AddInt64(&retries, int64(attempts-1))
+
+				if err != nil {
+					atomic.AddInt64(&errs, 1)
+				} else {
+					mu.Lock()
+					r.Nodes[uri]++
+					mu.Unlock()
+				}
+			}
+
+			mu.Lock()
+			r.Latencies = append(r.Latencies, latencies...)
+			mu.Unlock()
+		}(int64(w) + start.UnixNano())
+	}
+
+	wg.Wait()
+
+	r.Elapsed = time.Since(start)
+	r.Requests = int64(len(r.Latencies))
+	r.Errors = errs
+	r.Retries = retries
+	sort.Slice(r.Latencies, func(i, j int) bool { return r.Latencies[i] < r.Latencies[j] })
+
+	return r
+}
+
+// request runs the workload on nodes which are acquired from Transport, so
+// that workers run concurrently. It retries as Transport does, and reports
+// failed attempts to fail.
+func (b *Bench) request(elapsed time.Duration, rnd *rand.Rand, fail func(uri string)) (string, int, error) {
+	for attempts := 1; ; attempts++ {
+		a, err := b.Transport.Acquire(context.Background(), "")
+		if err != nil {
+			return "", attempts, err
+		}
+
+		err = b.do(a.URI, elapsed, rnd)
+		a.End(err)
+		if err == nil {
+			return a.URI, attempts, nil
+		}
+		fail(a.URI)
+
+		retry := attempts <= b.MaxRetries
+		if ctbase.Classify(err) == ctbase.ErrorConnection {
+			retry = retry && b.RetryOnFailure
+		}
+		if !retry {
+			return a.URI, attempts, err
+		}
+	}
+}
+
+// do runs one of workload on the node, which fails by injected faults.
+func (b *Bench) do(uri string, elapsed time.Duration, rnd *rand.Rand) error {
+	for _, f := range b.Faults {
+		if f.URI == uri && elapsed >= f.After && rnd.Float64() < f.Rate {
+			return &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("injected fault on %s", uri)}
+		}
+	}
+
+	if b.Op != "dial" {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", ctbase.Addr(uri), b.DialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Percentile returns the latency at p (0-100).
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) <= 0 {
+		return 0
+	}
+
+	i := int(float64(len(r.Latencies)-1) * p / 100)
+	return r.Latencies[i]
+}
+
+// Throughput returns requests per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Elapsed.Seconds()
+}
+
+// Write writes a summary of the result.
+func (r *Result) Write(w io.Writer) error {
+	fmt.Fprintf(w, "requests:   %d (%d errors, %d retries)\n", r.Requests, r.Errors, r.Retries)
+	fmt.Fprintf(w, "elapsed:    %s\n", r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "throughput: %.1f req/s\n", r.Throughput())
+	fmt.Fprintf(w, "latency:    p50=%s p90=%s p99=%s max=%s\n\n",
+		r.Percentile(50), r.Percentile(90), r.Percentile(99), r.Percentile(100))
+
+	uris := make([]string, 0, len(r.Nodes)+len(r.Failed))
+	for uri := range r.Nodes {
+		uris = append(uris, uri)
+	}
+	for uri := range r.Failed {
+		if _, ok := r.Nodes[uri]; !ok {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Strings(uris)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tOK\tFAILED\tSHARE")
+	for _, uri := range uris {
+		share := 0.0
+		if r.Requests > 0 {
+			share = float64(r.Nodes[uri]) / float64(r.Requests) * 100
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\n", uri, r.Nodes[uri], r.Failed[uri], share)
+	}
+
+	return tw.Flush()
+}
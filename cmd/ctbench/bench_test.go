@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/ikeikeikeike/clustertransport-base/internal/clusters"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFault(t *testing.T) {
+	f, err := ParseFault("10.0.0.1:11211")
+	assert.NoError(t, err)
+	assert.Equal(t, Fault{URI: "10.0.0.1:11211", Rate: 1}, f)
+
+	f, err = ParseFault("http://10.0.0.1:9200@5s:0.25")
+	assert.NoError(t, err)
+	assert.Equal(t, Fault{URI: "http://10.0.0.1:9200", After: 5 * time.Second, Rate: 0.25}, f)
+
+	_, err = ParseFault("a:1@soon")
+	assert.Error(t, err)
+	_, err = ParseFault("a:1@1s:2")
+	assert.Error(t, err)
+}
+
+func TestParseSelector(t *testing.T) {
+	for _, name := range []string{"roundrobin", "random", "weighted", "label:zone=a"} {
+		_, err := ParseSelector(name)
+		assert.NoError(t, err, name)
+	}
+
+	_, err := ParseSelector("label:zone")
+	assert.Error(t, err)
+	_, err = ParseSelector("fastest")
+	assert.Error(t, err)
+}
+
+func TestBench(t *testing.T) {
+	uris := []string{"a:1", "b:1", "c:1"}
+
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = &clusters.Static{URIs: uris}
+	cfg.DiscoverOnFailure = false
+	cfg.DiscoverRatio = 0
+
+	b := &Bench{
+		Transport:      ctbase.NewTransport(cfg, uris...),
+		Concurrency:    4,
+		Requests:       300,
+		Faults:         []Fault{{URI: "b:1", Rate: 1}},
+		MaxRetries:     2,
+		RetryOnFailure: true,
+	}
+	r := b.Run()
+
+	// The node is dead after the first failure, which workers may hit at the same time.
+	assert.Equal(t, int64(300), r.Requests)
+	assert.Equal(t, int64(0), r.Errors)
+	assert.True(t, r.Retries >= 1 && r.Retries <= 4, r.Retries)
+	assert.Equal(t, r.Retries, r.Failed["b:1"])
+	assert.Equal(t, int64(0), r.Nodes["b:1"])
+	assert.Equal(t, int64(300), r.Nodes["a:1"]+r.Nodes["c:1"])
+	assert.True(t, r.Percentile(50) <= r.Percentile(99))
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Write(&buf))
+	assert.Contains(t, buf.String(), "requests:   300 (0 errors, ")
+	assert.Regexp(t, `b:1\s+0\s+[1-4]\s+0.0%`, buf.String())
+
+	// Failures aren't retried without RetryOnFailure.
+	cfg.Cluster = &clusters.Static{URIs: []string{"b:1"}}
+	b.Transport = ctbase.NewTransport(cfg, "b:1")
+	b.RetryOnFailure = false
+	r = b.Run()
+	assert.Equal(t, r.Requests, r.Errors)
+	assert.Equal(t, int64(0), r.Retries)
+}
+
+func TestRun(t *testing.T) {
+	opts := &clusters.Options{Type: "static", Seeds: "a:1,b:1", Timeout: time.Second}
+	plan := &Plan{Concurrency: 2, Requests: 10, Op: "noop", Selectors: "roundrobin,random", Retries: "0,1"}
+
+	var buf bytes.Buffer
+	assert.NoError(t, run(&buf, opts, plan, nil))
+	assert.Equal(t, 4, strings.Count(buf.String(), "== selector="))
+
+	plan.Selectors = "fastest"
+	assert.Error(t, run(&buf, opts, plan, nil))
+}
@@ -0,0 +1,138 @@
+// Command ctbench drives concurrent workloads through Transport against
+// nodes which are discovered by the adapter of -type. It runs the workload
+// per combination of selectors and retry policies, and reports throughput,
+// latency percentiles, distribution per node and retries.
+//
+//	ctbench -type memcached -seeds cfg.example.com:11211 -op dial \
+//		-selector roundrobin,weighted -retries 0,3 -fault 10.0.0.1:11211@5s:0.5
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/ikeikeikeike/clustertransport-base/internal/clusters"
+)
+
+type faultsFlag []Fault
+
+func (f *faultsFlag) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *faultsFlag) Set(s string) error {
+	fault, err := ParseFault(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, fault)
+	return nil
+}
+
+// Plan is flags of the workloads.
+type Plan struct {
+	Concurrency    int
+	Duration       time.Duration
+	Requests       int
+	Op             string
+	Selectors      string // Comma separated
+	Retries        string // Comma separated MaxRetries
+	RetryOnFailure bool
+	Faults         faultsFlag
+}
+
+func main() {
+	var (
+		opts clusters.Options
+		plan Plan
+	)
+	opts.Register(flag.CommandLine)
+	flag.IntVar(&plan.Concurrency, "concurrency", 8, "concurrent workers")
+	flag.DurationVar(&plan.Duration, "duration", 10*time.Second, "duration of a run")
+	flag.IntVar(&plan.Requests, "requests", 0, "requests of a run instead of -duration")
+	flag.StringVar(&plan.Op, "op", "noop", "workload: noop selects a node only, dial dials the node by TCP")
+	flag.StringVar(&plan.Selectors, "selector", "roundrobin", "comma separated selectors: roundrobin, random, weighted, label:key=value")
+	flag.StringVar(&plan.Retries, "retries", "5", "comma separated MaxRetries")
+	flag.BoolVar(&plan.RetryOnFailure, "retry-on-failure", false, "retries requests which failed by connection errors")
+	flag.Var(&plan.Faults, "fault", "injects failures: uri[@after[:rate]], repeatable")
+	flag.Parse()
+
+	if err := run(os.Stdout, &opts, &plan, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "ctbench:", err)
+		os.Exit(1)
+	}
+}
+
+func run(w io.Writer, opts *clusters.Options, plan *Plan, args []string) error {
+	seeds := opts.SeedURIs(args...)
+
+	cluster, err := clusters.New(opts, seeds)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	uris, err := clusters.Discover(ctx, cluster, seeds)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	var retries []int
+	for _, s := range strings.Split(plan.Retries, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return fmt.Errorf("invalid retries %q", s)
+		}
+		retries = append(retries, n)
+	}
+
+	for _, name := range strings.Split(plan.Selectors, ",") {
+		name = strings.TrimSpace(name)
+		for _, maxRetries := range retries {
+			// Selectors have state, so that it's built per run.
+			selector, err := ParseSelector(name)
+			if err != nil {
+				return err
+			}
+
+			cfg := ctbase.NewConfig()
+			cfg.Cluster = cluster
+			cfg.Selector = selector
+			cfg.Discover = false
+			cfg.DiscoverOnFailure = false
+			cfg.DiscoverRatio = 0
+
+			b := &Bench{
+				Transport:   ctbase.NewTransport(cfg, uris...),
+				Concurrency: plan.Concurrency,
+				Duration:    plan.Duration,
+				Requests:    plan.Requests,
+				Op:          plan.Op,
+				DialTimeout: opts.Timeout,
+				Faults:      plan.Faults,
+
+				MaxRetries:     maxRetries,
+				RetryOnFailure: plan.RetryOnFailure,
+			}
+
+			fmt.Fprintf(w, "== selector=%s retries=%d retry-on-failure=%v concurrency=%d op=%s\n",
+				name, maxRetries, plan.RetryOnFailure, plan.Concurrency, plan.Op)
+			r := b.Run()
+			b.Transport.Close()
+			if err := r.Write(w); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/ikeikeikeike/clustertransport-base/internal/clusters"
+)
+
+// Node is one of node which was discovered.
+type Node struct {
+	URI       string            `json:"uri"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Reachable bool              `json:"reachable"`
+	Latency   time.Duration     `json:"latency"` // Round-trip time of TCP handshake
+	Error     string            `json:"error,omitempty"`
+}
+
+// Report is a result of a discovery run.
+type Report struct {
+	Type  string    `json:"type"`
+	Seeds []string  `json:"seeds"`
+	At    time.Time `json:"at"`
+	Nodes []Node    `json:"nodes"`
+}
+
+// Inspect discovers nodes via seeds, and then checks each of them.
+func Inspect(ctx context.Context, typ string, cluster ctbase.ClusterBase, seeds []string, timeout time.Duration) (*Report, error) {
+	uris, err := clusters.Discover(ctx, cluster, seeds)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Report{Type: typ, Seeds: seeds, At: time.Now(), Nodes: make([]Node, len(uris))}
+
+	done := make(chan struct{}, len(uris))
+	for i, uri := range uris {
+		go func(i int, uri string) {
+			r.Nodes[i] = probe(ctx, cluster, uri, timeout)
+			done <- struct{}{}
+		}(i, uri)
+	}
+	for range uris {
+		<-done
+	}
+
+	return r, nil
+}
+
+// probe measures reachability of the node by TCP handshake.
+func probe(ctx context.Context, cluster ctbase.ClusterBase, uri string, timeout time.Duration) Node {
+	node := Node{URI: uri, Labels: labels(ctx, cluster, uri)}
+
+	d := net.Dialer{Timeout: timeout}
+	start := time.Now()
+
+	conn, err := d.DialContext(ctx, "tcp", ctbase.Addr(uri))
+	if err != nil {
+		node.Error = err.Error()
+		return node
+	}
+	conn.Close()
+
+	node.Reachable, node.Latency = true, time.Since(start)
+	return node
+}
+
+// labels returns labels of the node, which falls back to labels of the
+// connection when the cluster labels it while connecting.
+func labels(ctx context.Context, cluster ctbase.ClusterBase, uri string) map[string]string {
+	if lb, ok := cluster.(ctbase.LabelBase); ok {
+		return lb.Labels(uri)
+	}
+
+	var (
+		conn *ctbase.Conn
+		err  error
+	)
+	if cc, ok := cluster.(ctbase.ClusterContextBase); ok {
+		conn, err = cc.ConnContext(ctx, uri)
+	} else {
+		conn, err = cluster.Conn(uri)
+	}
+	if err != nil || conn == nil {
+		return nil
+	}
+	return conn.Labels
+}
+
+// WriteTable writes the report as a table.
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URI\tREACHABLE\tLATENCY\tLABELS")
+
+	for _, n := range r.Nodes {
+		latency := "-"
+		if n.Reachable {
+			latency = n.Latency.Round(10 * time.Microsecond).String()
+		}
+		reachable := "yes"
+		if !n.Reachable {
+			reachable = "no"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", n.URI, reachable, latency, formatLabels(n.Labels))
+	}
+
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ReadReport reads the report which was written by WriteJSON.
+func ReadReport(rd io.Reader) (*Report, error) {
+	r := &Report{}
+	if err := json.NewDecoder(rd).Decode(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Change is a difference of a node between two reports.
+type Change struct {
+	URI    string
+	Kind   string // "added", "removed" or "changed"
+	Detail []string
+}
+
+// Diff compares two reports, which ignores latency.
+func Diff(old, cur *Report) []Change {
+	olds := make(map[string]Node, len(old.Nodes))
+	for _, n := range old.Nodes {
+		olds[n.URI] = n
+	}
+	curs := make(map[string]Node, len(cur.Nodes))
+	for _, n := range cur.Nodes {
+		curs[n.URI] = n
+	}
+
+	var changes []Change
+	for _, n := range cur.Nodes {
+		o, ok := olds[n.URI]
+		if !ok {
+			changes = append(changes, Change{URI: n.URI, Kind: "added"})
+			continue
+		}
+
+		var detail []string
+		if o.Reachable != n.Reachable {
+			detail = append(detail, fmt.Sprintf("reachable: %v -> %v", o.Reachable, n.Reachable))
+		}
+		for _, k := range labelKeys(o.Labels, n.Labels) {
+			ov, ook := o.Labels[k]
+			nv, nok := n.Labels[k]
+			switch {
+			case !ook:
+				detail = append(detail, fmt.Sprintf("label %s: + %s", k, nv))
+			case !nok:
+				detail = append(detail, fmt.Sprintf("label %s: - %s", k, ov))
+			case ov != nv:
+				detail = append(detail, fmt.Sprintf("label %s: %s -> %s", k, ov, nv))
+			}
+		}
+		if len(detail) > 0 {
+			changes = append(changes, Change{URI: n.URI, Kind: "changed", Detail: detail})
+		}
+	}
+	for _, n := range old.Nodes {
+		if _, ok := curs[n.URI]; !ok {
+			changes = append(changes, Change{URI: n.URI, Kind: "removed"})
+		}
+	}
+
+	return changes
+}
+
+// WriteDiff writes changes like a unified diff.
+func WriteDiff(w io.Writer, changes []Change) {
+	if len(changes) <= 0 {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+
+	for _, c := range changes {
+		switch c.Kind {
+		case "added":
+			fmt.Fprintf(w, "+ %s\n", c.URI)
+		case "removed":
+			fmt.Fprintf(w, "- %s\n", c.URI)
+		default:
+			fmt.Fprintf(w, "~ %s\n", c.URI)
+			for _, d := range c.Detail {
+				fmt.Fprintf(w, "    %s\n", d)
+			}
+		}
+	}
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) <= 0 {
+		return "-"
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, k := range labelKeys(labels) {
+		pairs = append(pairs, k+"="+labels[k])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func labelKeys(labels ...map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range labels {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/ikeikeikeike/clustertransport-base/internal/clusters"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeNodes(t *testing.T, dir, contents string) string {
+	path := filepath.Join(dir, "nodes.txt")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestRun(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	down, _ := net.Listen("tcp", "127.0.0.1:0")
+	down.Close()
+
+	up, gone := ln.Addr().String(), down.Addr().String()
+
+	dir := t.TempDir()
+	opts := &clusters.Options{Type: "file", Timeout: time.Second}
+	opts.File = writeNodes(t, dir, up+" zone=a\n"+gone+" zone=b\n")
+
+	var buf bytes.Buffer
+	assert.NoError(t, run(&buf, opts, false, "", "", nil))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^URI\s+REACHABLE\s+LATENCY\s+LABELS$`, lines[0])
+	assert.Regexp(t, `^`+up+`\s+yes\s+\S+\s+zone=a$`, lines[1])
+	assert.Regexp(t, `^`+gone+`\s+no\s+-\s+zone=b$`, lines[2])
+
+	// A report is compared with the next run.
+	buf.Reset()
+	assert.NoError(t, run(&buf, opts, true, "", "", nil))
+	before := filepath.Join(dir, "before.json")
+	assert.NoError(t, ioutil.WriteFile(before, buf.Bytes(), 0644))
+
+	opts.File = writeNodes(t, dir, up+" zone=c\n127.0.0.1:1\n")
+
+	buf.Reset()
+	assert.NoError(t, run(&buf, opts, false, before, "", nil))
+	changes := "~ " + up + "\n    label zone: a -> c\n+ 127.0.0.1:1\n- " + gone + "\n"
+	assert.Equal(t, changes, buf.String())
+
+	// A positional argument is a seed, which isn't taken as a report.
+	buf.Reset()
+	assert.NoError(t, run(&buf, opts, false, before, "", []string{up}))
+	assert.Equal(t, changes, buf.String())
+
+	// Two reports are compared without discovery.
+	buf.Reset()
+	assert.NoError(t, run(&buf, opts, false, before, before, nil))
+	assert.Equal(t, "no changes\n", buf.String())
+	assert.Error(t, run(&buf, opts, false, "", before, nil))
+
+	assert.Error(t, run(&buf, opts, false, filepath.Join(dir, "missing.json"), "", nil))
+	assert.Error(t, run(&buf, &clusters.Options{Type: "unknown"}, false, "", "", nil))
+}
+
+func TestDiff(t *testing.T) {
+	old := &Report{Nodes: []Node{
+		{URI: "a:1", Reachable: true, Labels: map[string]string{"role": "primary", "dc": "1"}},
+		{URI: "b:1", Reachable: true},
+	}}
+	cur := &Report{Nodes: []Node{
+		{URI: "a:1", Reachable: false, Labels: map[string]string{"role": "replica", "rack": "r1"}},
+		{URI: "b:1", Reachable: true, Latency: time.Second},
+	}}
+
+	assert.Equal(t, []Change{{URI: "a:1", Kind: "changed", Detail: []string{
+		"reachable: true -> false",
+		"label dc: - 1",
+		"label rack: + r1",
+		"label role: primary -> replica",
+	}}}, Diff(old, cur))
+}
+
+// connLabeled labels connections while connecting, as elasticsearch does.
+type connLabeled struct{}
+
+func (connLabeled) Sniff(conn *ctbase.Conn) []string { return nil }
+func (connLabeled) Conn(uri string) (*ctbase.Conn, error) {
+	return &ctbase.Conn{Labels: map[string]string{"role": "master"}}, nil
+}
+
+func TestLabels(t *testing.T) {
+	assert.Equal(t, map[string]string{"role": "master"}, labels(context.Background(), connLabeled{}, "a:1"))
+
+	fc := &ctbase.FileCluster{}
+	assert.Nil(t, labels(context.Background(), fc, "a:1"))
+}
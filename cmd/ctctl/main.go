@@ -0,0 +1,95 @@
+// Command ctctl inspects topology of cluster systems, which runs discovery
+// through the adapter of -type and prints discovered nodes, their labels,
+// reachability and round-trip latency.
+//
+//	ctctl -type elasticsearch -seeds http://10.0.0.1:9200
+//	ctctl -type redis-cluster -seeds 10.0.0.1:6379 -json > before.json
+//	ctctl -type redis-cluster -seeds 10.0.0.1:6379 -diff before.json
+//	ctctl -diff before.json -against after.json
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ikeikeikeike/clustertransport-base/internal/clusters"
+)
+
+func main() {
+	var (
+		opts    clusters.Options
+		asJSON  = flag.Bool("json", false, "prints as JSON, which is able to be compared by -diff")
+		diff    = flag.String("diff", "", "compares with a report which was printed by -json")
+		against = flag.String("against", "", "compares -diff with this report instead of discovery")
+	)
+	opts.Register(flag.CommandLine)
+	flag.Parse()
+
+	if err := run(os.Stdout, &opts, *asJSON, *diff, *against, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "ctctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(w io.Writer, opts *clusters.Options, asJSON bool, diff, against string, args []string) error {
+	// Two reports are compared without discovery.
+	if against != "" {
+		if diff == "" {
+			return fmt.Errorf("-against requires -diff")
+		}
+
+		old, err := readReport(diff)
+		if err != nil {
+			return err
+		}
+		cur, err := readReport(against)
+		if err != nil {
+			return err
+		}
+
+		WriteDiff(w, Diff(old, cur))
+		return nil
+	}
+
+	seeds := opts.SeedURIs(args...)
+
+	cluster, err := clusters.New(opts, seeds)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*opts.Timeout)
+	defer cancel()
+
+	r, err := Inspect(ctx, opts.Type, cluster, seeds, opts.Timeout)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case diff != "":
+		old, err := readReport(diff)
+		if err != nil {
+			return err
+		}
+		WriteDiff(w, Diff(old, r))
+		return nil
+	case asJSON:
+		return r.WriteJSON(w)
+	default:
+		return r.WriteTable(w)
+	}
+}
+
+func readReport(path string) (*Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadReport(f)
+}
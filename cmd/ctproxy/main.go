@@ -0,0 +1,113 @@
+// Command ctproxy is a TCP load-balancing proxy, which forwards each
+// accepted connection to one of cluster nodes that's selected by Transport.
+// It's run as a sidecar for applications which accept only a single
+// host:port, such as memcached or Elasticsearch clients.
+//
+//	ctproxy -listen 127.0.0.1:11211 -type memcached -seeds cfg.example.com:11211
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/ikeikeikeike/clustertransport-base/internal/clusters"
+)
+
+func main() {
+	var (
+		opts     clusters.Options
+		listen   = flag.String("listen", "127.0.0.1:11211", "address to listen")
+		retries  = flag.Int("retries", 2, "dials other nodes when dialing failed")
+		drain    = flag.Duration("drain", 30*time.Second, "waits for connections to be closed on shutdown")
+		stats    = flag.Duration("stats", time.Minute, "logs connection counts per backend, 0 disables it")
+		discover = flag.Int("discover-tick", 120, "discovers nodes per secs")
+		debug    = flag.Bool("debug", false, "logs transport's messages")
+	)
+	opts.Register(flag.CommandLine)
+	flag.Parse()
+
+	if err := run(&opts, *listen, *retries, *drain, *stats, *discover, *debug); err != nil {
+		fmt.Fprintln(os.Stderr, "ctproxy:", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts *clusters.Options, listen string, retries int, drain, stats time.Duration, discover int, debug bool) error {
+	seeds := opts.SeedURIs(flag.Args()...)
+
+	cluster, err := clusters.New(opts, seeds)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	uris, err := clusters.Discover(ctx, cluster, seeds)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = cluster
+	cfg.DiscoverTick = discover
+	cfg.SniffTimeout = int(opts.Timeout / time.Second)
+	cfg.DialTimeout = int(opts.Timeout / time.Second)
+	if debug {
+		cfg.Logger = log.Printf
+	}
+	ts := ctbase.NewTransport(cfg, uris...)
+	clusters.Watch(cluster, ts)
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	log.Printf("Forwarding %s to %d nodes of %s", ln.Addr(), len(uris), opts.Type)
+
+	p := &Proxy{Transport: ts, DialTimeout: opts.Timeout, Retries: retries}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	var tick <-chan time.Time
+	if stats > 0 {
+		t := time.NewTicker(stats)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- p.Serve(ln) }()
+
+	for {
+		select {
+		case <-tick:
+			logBackends(p)
+		case err := <-served:
+			return err
+		case s := <-sig:
+			log.Printf("Shutting down by %s, waiting for connections up to %s", s, drain)
+
+			ctx, cancel := context.WithTimeout(context.Background(), drain)
+			defer cancel()
+
+			err := p.Shutdown(ctx, ln)
+			logBackends(p)
+			return err
+		}
+	}
+}
+
+func logBackends(p *Proxy) {
+	for _, b := range p.Backends() {
+		log.Printf("backend=%s active=%d total=%d failed=%d", b.URI, b.Active, b.Total, b.Failed)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+)
+
+// Proxy forwards accepted TCP connections to nodes which are selected by Transport.
+type Proxy struct {
+	Transport   *ctbase.Transport
+	DialTimeout time.Duration
+	Retries     int // Dials other nodes when dialing failed
+	Logger      func(format string, params ...interface{})
+
+	mu       sync.Mutex
+	backends map[string]*Backend
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup // Accepted connections
+	closing  bool
+	closed   bool // Connections were closed forcibly
+}
+
+// Backend is connection counts of a node.
+type Backend struct {
+	URI    string
+	Active int64
+	Total  int64
+	Failed int64 // Failures of dialing
+}
+
+// Serve accepts connections until ln is closed.
+func (p *Proxy) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closing := p.closing
+			p.mu.Unlock()
+
+			if closing {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		if !p.track(conn, true) {
+			conn.Close()
+			continue
+		}
+		go p.handle(conn)
+	}
+}
+
+// Shutdown stops accepting, and then waits for connections to be closed
+// until ctx is done. Connections which are left are closed forcibly.
+func (p *Proxy) Shutdown(ctx context.Context, ln net.Listener) error {
+	p.mu.Lock()
+	p.closing = true
+	p.mu.Unlock()
+	ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	p.closed = true
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+
+	<-done
+	return ctx.Err()
+}
+
+// Backends returns connection counts per node in order of uri.
+func (p *Proxy) Backends() []Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	backends := make([]Backend, 0, len(p.backends))
+	for _, b := range p.backends {
+		backends = append(backends, *b)
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].URI < backends[j].URI })
+
+	return backends
+}
+
+func (p *Proxy) handle(client net.Conn) {
+	defer p.untrack(client, true)
+
+	backend, uri, err := p.dial()
+	if err != nil {
+		p.logger()("Failed to forward %s: %s", client.RemoteAddr(), err)
+		return
+	}
+	defer p.release(uri)
+
+	if !p.track(backend, false) {
+		backend.Close()
+		return
+	}
+	defer p.untrack(backend, false)
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		if tc, ok := dst.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		} else {
+			dst.Close()
+		}
+		done <- struct{}{}
+	}
+
+	go pipe(backend, client)
+	go pipe(client, backend)
+	<-done
+	<-done
+}
+
+// dial connects to one of nodes, which marks the node as dead on failure
+// and then tries another one. It's dialed outside of the goroutine which
+// handles requests of Transport.
+func (p *Proxy) dial() (net.Conn, string, error) {
+	var lastErr error
+
+	for tries := 0; tries <= p.Retries; tries++ {
+		a, err := p.Transport.Acquire(context.Background(), "")
+		if err != nil {
+			return nil, "", err
+		}
+		uri := a.URI
+
+		conn, err := net.DialTimeout("tcp", ctbase.Addr(uri), p.DialTimeout)
+		a.End(err)
+
+		if err == nil {
+			p.acquire(uri)
+			return conn, uri, nil
+		}
+
+		p.fail(uri)
+		p.logger()("Failed to dial %s: %s", uri, err)
+		lastErr = err
+	}
+
+	return nil, "", lastErr
+}
+
+// track tracks the connection to be closed on shutdown, and accepted ones
+// to be waited for. It reports false when accepted one is too late for
+// shutdown, or when connections were closed forcibly already.
+func (p *Proxy) track(conn net.Conn, accepted bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || (accepted && p.closing) {
+		return false
+	}
+
+	if p.conns == nil {
+		p.conns = make(map[net.Conn]struct{})
+	}
+	p.conns[conn] = struct{}{}
+	if accepted {
+		p.wg.Add(1)
+	}
+	return true
+}
+
+func (p *Proxy) untrack(conn net.Conn, accepted bool) {
+	conn.Close()
+
+	p.mu.Lock()
+	delete(p.conns, conn)
+	p.mu.Unlock()
+
+	if accepted {
+		p.wg.Done()
+	}
+}
+
+func (p *Proxy) backend(uri string) *Backend {
+	if p.backends == nil {
+		p.backends = make(map[string]*Backend)
+	}
+	b, ok := p.backends[uri]
+	if !ok {
+		b = &Backend{URI: uri}
+		p.backends[uri] = b
+	}
+	return b
+}
+
+func (p *Proxy) acquire(uri string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := p.backend(uri)
+	b.Active++
+	b.Total++
+}
+
+func (p *Proxy) release(uri string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.backend(uri).Active--
+}
+
+func (p *Proxy) fail(uri string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.backend(uri).Failed++
+}
+
+func (p *Proxy) logger() func(format string, params ...interface{}) {
+	if p.Logger == nil {
+		return log.Printf
+	}
+	return p.Logger
+}
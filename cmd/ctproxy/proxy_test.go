@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/ikeikeikeike/clustertransport-base/internal/clusters"
+	"github.com/stretchr/testify/assert"
+)
+
+// echo answers name and a line which is received.
+func echo(t *testing.T, name string) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fmt.Fprintf(conn, "%s %s", name, line)
+				}
+			}()
+		}
+	}()
+
+	return ln
+}
+
+func newProxy(t *testing.T, uris ...string) (*Proxy, net.Listener) {
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = &clusters.Static{URIs: uris}
+	cfg.DiscoverOnFailure = false
+	cfg.DiscoverRatio = 0
+
+	p := &Proxy{
+		Transport:   ctbase.NewTransport(cfg, uris...),
+		DialTimeout: time.Second,
+		Retries:     2,
+		Logger:      ctbase.PrintNothing,
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go p.Serve(ln)
+
+	return p, ln
+}
+
+func roundTrip(t *testing.T, addr, line string) string {
+	conn, err := net.Dial("tcp", addr)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer conn.Close()
+
+	fmt.Fprintln(conn, line)
+	reply, _ := bufio.NewReader(conn).ReadString('\n')
+	return reply
+}
+
+func TestProxy(t *testing.T) {
+	b1, b2 := echo(t, "b1"), echo(t, "b2")
+	defer b1.Close()
+	defer b2.Close()
+
+	down, _ := net.Listen("tcp", "127.0.0.1:0")
+	down.Close()
+
+	p, ln := newProxy(t, b1.Addr().String(), down.Addr().String(), "tcp://"+b2.Addr().String())
+	defer ln.Close()
+
+	replies := map[string]int{}
+	for i := 0; i < 6; i++ {
+		replies[roundTrip(t, ln.Addr().String(), "ping")]++
+	}
+	assert.Len(t, replies, 2)
+	assert.Equal(t, 6, replies["b1 ping\n"]+replies["b2 ping\n"])
+
+	// Forwarding finishes after the client closed the connection.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && active(p) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	backends := p.Backends()
+	assert.Len(t, backends, 3)
+
+	var total int64
+	for _, b := range backends {
+		assert.Equal(t, int64(0), b.Active)
+		if b.URI == down.Addr().String() {
+			assert.Equal(t, int64(1), b.Failed)
+		} else {
+			total += b.Total
+		}
+	}
+	assert.Equal(t, int64(6), total)
+}
+
+func active(p *Proxy) int64 {
+	var n int64
+	for _, b := range p.Backends() {
+		n += b.Active
+	}
+	return n
+}
+
+func TestShutdown(t *testing.T) {
+	b1 := echo(t, "b1")
+	defer b1.Close()
+
+	p, ln := newProxy(t, b1.Addr().String())
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	fmt.Fprintln(conn, "first")
+	reply, _ := r.ReadString('\n')
+	assert.Equal(t, "b1 first\n", reply)
+	assert.Equal(t, int64(1), p.Backends()[0].Active)
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		done <- p.Shutdown(ctx, ln)
+	}()
+
+	// Connections which are open keep working while draining.
+	time.Sleep(50 * time.Millisecond)
+	fmt.Fprintln(conn, "draining")
+	reply, _ = r.ReadString('\n')
+	assert.Equal(t, "b1 draining\n", reply)
+
+	_, err = net.DialTimeout("tcp", ln.Addr().String(), 100*time.Millisecond)
+	assert.Error(t, err)
+
+	// It's closed forcibly after the deadline.
+	assert.Equal(t, context.DeadlineExceeded, <-done)
+	assert.Equal(t, int64(0), p.Backends()[0].Active)
+}
+
+func TestTrackAfterShutdown(t *testing.T) {
+	p := &Proxy{}
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	// Connections which are accepted while shutting down aren't waited for.
+	p.closing = true
+	assert.False(t, p.track(c1, true))
+	assert.True(t, p.track(c2, false))
+	p.untrack(c2, false)
+
+	p.closed = true
+	assert.False(t, p.track(c2, false))
+}
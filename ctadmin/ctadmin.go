@@ -0,0 +1,233 @@
+// Package ctadmin provides http.Handler which renders states of registered
+// transports as HTML and JSON, and lets operators mark a node dead or alive,
+// drain a node or rediscover nodes without redeploying when actions are
+// enabled.
+//
+//	ctadmin.Register("memcached", transport)
+//	http.Handle("/debug/clustertransport", ctadmin.NewHandler(nil))
+package ctadmin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+)
+
+// Actions which are requested by POST with `transport`, `action` and `uri`
+// form values.
+const (
+	ActionDead     = "dead"
+	ActionAlive    = "alive"
+	ActionDrain    = "drain"
+	ActionUndrain  = "undrain"
+	ActionDiscover = "discover"
+)
+
+// NewHandler returns Handler which renders transports of r. DefaultRegistry
+// is used when r is nil.
+func NewHandler(r *Registry) *Handler {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	return &Handler{Registry: r, DiscoverTimeout: 10 * time.Second}
+}
+
+// Handler implements http.Handler interface. GET renders transports as HTML,
+// or JSON by `?format=json` or the Accept header, and POST runs an action
+// when Actions is enabled.
+type Handler struct {
+	Registry        *Registry
+	Actions         bool          // Default: Mutating actions are disabled
+	CrossOrigin     bool          // Default: Rejects actions which are requested by other origins
+	DiscoverTimeout time.Duration // Default: Gives up rediscovery after 10 sec
+
+	// Authorize guards mutating actions, which rejects the request when it
+	// returns an error.
+	Authorize func(r *http.Request) error
+}
+
+// Status is a state of the registered transport.
+type Status struct {
+	Name        string           `json:"name"`
+	Snapshot    *ctbase.Snapshot `json:"snapshot"`
+	Events      []Event          `json:"events"`
+	Discoveries []Event          `json:"discoveries"`
+}
+
+type page struct {
+	ReadOnly   bool     `json:"readOnly"`
+	Transports []Status `json:"transports"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		h.render(w, r)
+	case http.MethodPost:
+		h.act(w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) render(w http.ResponseWriter, r *http.Request) {
+	p := &page{ReadOnly: !h.Actions, Transports: []Status{}}
+
+	only := r.URL.Query().Get("transport")
+	for _, name := range h.Registry.Names() {
+		if only != "" && only != name {
+			continue
+		}
+
+		t := h.Registry.Transport(name)
+		if t == nil {
+			continue
+		}
+
+		p.Transports = append(p.Transports, Status{
+			Name:        name,
+			Snapshot:    t.Snapshot(),
+			Events:      h.Registry.RecentEvents(name),
+			Discoveries: h.Registry.RecentDiscoveries(name),
+		})
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, p)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := index.Execute(w, p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) act(w http.ResponseWriter, r *http.Request) {
+	if !h.Actions {
+		http.Error(w, "actions are disabled", http.StatusForbidden)
+		return
+	}
+	if !h.CrossOrigin {
+		if err := sameOrigin(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	if h.Authorize != nil {
+		if err := h.Authorize(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	name, action, uri := r.FormValue("transport"), r.FormValue("action"), r.FormValue("uri")
+
+	t := h.Registry.Transport(name)
+	if t == nil {
+		http.Error(w, fmt.Sprintf("transport %q is not registered", name), http.StatusNotFound)
+		return
+	}
+
+	status, err := h.do(r, t, action, uri)
+	if status == http.StatusBadRequest {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	ev := Event{At: time.Now(), Action: action, URI: uri}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	h.Registry.record(name, ev)
+
+	if wantsJSON(r) {
+		writeJSON(w, status, ev)
+		return
+	}
+	http.Redirect(w, r, r.RequestURI, http.StatusSeeOther)
+}
+
+func (h *Handler) do(r *http.Request, t *ctbase.Transport, action, uri string) (int, error) {
+	var fun func(string) bool
+
+	switch action {
+	case ActionDead:
+		fun = t.MarkDead
+	case ActionAlive:
+		fun = t.MarkAlive
+	case ActionDrain:
+		fun = t.Drain
+	case ActionUndrain:
+		fun = t.Undrain
+	case ActionDiscover:
+		ctx := r.Context()
+		if h.DiscoverTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, h.DiscoverTimeout)
+			defer cancel()
+		}
+
+		if err := t.Discover(ctx); err != nil {
+			return http.StatusBadGateway, err
+		}
+		return http.StatusOK, nil
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unknown action %q", action)
+	}
+
+	if !fun(uri) {
+		return http.StatusNotFound, fmt.Errorf("node %q is not found", uri)
+	}
+	return http.StatusOK, nil
+}
+
+// sameOrigin rejects the request which is sent by browsers from other
+// origins, which is reported by Sec-Fetch-Site, Origin or Referer headers.
+// Requests without them, such as by curl, are accepted.
+func sameOrigin(r *http.Request) error {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return errors.New("cross-origin actions are rejected")
+	}
+
+	for _, name := range []string{"Origin", "Referer"} {
+		v := r.Header.Get(name)
+		if v == "" {
+			continue
+		}
+
+		u, err := url.Parse(v)
+		if err != nil || u.Host != r.Host {
+			return fmt.Errorf("cross-origin actions are rejected: %s %q", name, v)
+		}
+		return nil
+	}
+
+	return nil
+}
+
+func wantsJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
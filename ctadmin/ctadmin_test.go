@@ -0,0 +1,190 @@
+package ctadmin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCluster struct{ uris []string }
+
+func (c *stubCluster) Sniff(conn *ctbase.Conn) []string      { return c.uris }
+func (c *stubCluster) Conn(uri string) (*ctbase.Conn, error) { return &ctbase.Conn{}, nil }
+
+func newTransport(uris ...string) *ctbase.Transport {
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = &stubCluster{uris: uris}
+	cfg.DiscoverOnFailure = false
+	cfg.DiscoverRatio = 0
+	return ctbase.NewTransport(cfg, uris...)
+}
+
+func post(h http.Handler, form url.Values, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/debug/clustertransport", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", accept)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func get(h http.Handler, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Register("cache", newTransport("127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"))
+	r.Register("search", newTransport("127.0.0.1:9200"))
+	h := NewHandler(r)
+	h.Actions = true
+
+	rec := get(h, "/debug/clustertransport?format=json")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var p page
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	assert.Len(t, p.Transports, 2)
+	assert.Equal(t, "cache", p.Transports[0].Name)
+	assert.Equal(t, 3, p.Transports[0].Snapshot.Alives)
+
+	// Marks a node dead by the form, and then it's redirected to the page.
+	rec = post(h, url.Values{"transport": {"cache"}, "action": {"dead"}, "uri": {"127.0.0.1:1"}}, "text/html")
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/debug/clustertransport", rec.Header().Get("Location"))
+
+	rec = post(h, url.Values{"transport": {"cache"}, "action": {"drain"}, "uri": {"127.0.0.1:2"}}, "application/json")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = post(h, url.Values{"transport": {"cache"}, "action": {"alive"}, "uri": {"127.0.0.1:9"}}, "application/json")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = post(h, url.Values{"transport": {"cache"}, "action": {"discover"}}, "application/json")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = post(h, url.Values{"transport": {"cache"}, "action": {"explode"}}, "application/json")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = post(h, url.Values{"transport": {"db"}, "action": {"discover"}}, "application/json")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	s := r.Transport("cache").Snapshot()
+	assert.Equal(t, 1, s.Deads)
+	assert.Equal(t, 1, s.Drained)
+
+	events := r.RecentEvents("cache")
+	assert.Len(t, events, 4)
+	assert.Equal(t, "discover", events[0].Action)
+	assert.Contains(t, events[1].Error, "not found")
+
+	rec = get(h, "/debug/clustertransport?transport=cache")
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.Contains(t, body, "<h2>cache</h2>")
+	assert.NotContains(t, body, "<h2>search</h2>")
+	assert.Contains(t, body, `value="alive">mark alive</button>`)
+	assert.Contains(t, body, `value="undrain">undrain</button>`)
+	assert.Contains(t, body, "127.0.0.1:9&#34; is not found")
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("DELETE", "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHandlerGuard(t *testing.T) {
+	r := NewRegistry()
+	r.Register("cache", newTransport("127.0.0.1:1", "127.0.0.1:2"))
+	h := NewHandler(r)
+	form := url.Values{"transport": {"cache"}, "action": {"dead"}, "uri": {"127.0.0.1:1"}}
+
+	// Actions are disabled by default.
+	assert.Equal(t, http.StatusForbidden, post(h, form, "application/json").Code)
+	assert.NotContains(t, get(h, "/").Body.String(), "<button")
+
+	h.Actions = true
+	for name, value := range map[string]string{
+		"Sec-Fetch-Site": "cross-site",
+		"Origin":         "http://evil.example",
+		"Referer":        "http://evil.example/page",
+	} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(name, value)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code, name)
+	}
+
+	// The same origin is accepted.
+	req := httptest.NewRequest("POST", "/", strings.NewReader(url.Values{"transport": {"cache"}, "action": {"discover"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "http://"+req.Host)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+
+	h.Authorize = func(r *http.Request) error {
+		if r.Header.Get("X-Token") != "secret" {
+			return errors.New("invalid token")
+		}
+		return nil
+	}
+	rec = post(h, form, "application/json")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid token")
+	assert.Equal(t, 0, r.Transport("cache").Snapshot().Deads)
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Events = 2
+	r.Register("b", newTransport("127.0.0.1:1"))
+	r.Register("a", newTransport("127.0.0.1:1"))
+	assert.Equal(t, []string{"a", "b"}, r.Names())
+
+	for _, action := range []string{"1", "2", "3"} {
+		r.record("a", Event{Action: action})
+	}
+	r.record("c", Event{Action: "1"})
+	assert.Equal(t, []Event{{Action: "3"}, {Action: "2"}}, r.RecentEvents("a"))
+
+	r.Unregister("a")
+	assert.Equal(t, []string{"b"}, r.Names())
+	assert.Nil(t, r.Transport("a"))
+	assert.Nil(t, r.RecentEvents("a"))
+}
+
+func TestRegistryMetrics(t *testing.T) {
+	r := NewRegistry()
+
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = &stubCluster{uris: []string{"127.0.0.1:1"}}
+	cfg.Metrics = r.Metrics("cache", nil)
+	ts := ctbase.NewTransport(cfg, "127.0.0.1:1")
+	r.Register("cache", ts)
+
+	// Discoveries of Transport are recorded apart from actions.
+	assert.NoError(t, ts.Discover(context.Background()))
+	assert.Eventually(t, func() bool {
+		evs := r.RecentDiscoveries("cache")
+		return len(evs) > 0 && evs[0].Action != "" && evs[0].Error == ""
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, r.RecentEvents("cache"))
+
+	r.Events = 1
+	r.recordDiscovery("cache", Event{Action: "refresh", Error: "unreachable"})
+	assert.Equal(t, []Event{{Action: "refresh", Error: "unreachable"}}, r.RecentDiscoveries("cache"))
+}
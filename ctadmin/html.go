@@ -0,0 +1,99 @@
+package ctadmin
+
+import (
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+)
+
+var index = template.Must(template.New("index").Funcs(template.FuncMap{
+	"labels": func(labels map[string]string) string {
+		pairs := make([]string, 0, len(labels))
+		for k, v := range labels {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	},
+	"since": func(at time.Time) string {
+		if at.IsZero() {
+			return "-"
+		}
+		return time.Since(at).Round(time.Second).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>clustertransport</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.dead { color: #c00; }
+.drained { color: #999; }
+form { display: inline; }
+</style>
+</head>
+<body>
+{{- $readOnly := .ReadOnly}}
+{{- range .Transports}}
+{{- $name := .Name}}
+<h2>{{.Name}}</h2>
+<p>
+alives:{{.Snapshot.Alives}} deads:{{.Snapshot.Deads}} drained:{{.Snapshot.Drained}} pending:{{.Snapshot.Pending}}
+cluster:{{.Snapshot.Config.Cluster}} selector:{{.Snapshot.Config.Selector}}
+</p>
+<p>
+discovery: {{if .Snapshot.Discovery.Discovering}}running{{else}}idle{{end}},
+last finished {{since .Snapshot.Discovery.FinishedAt}}
+{{- with .Snapshot.Discovery.Error}}, <span class="dead">{{.}}</span>{{end}}
+{{- if not $readOnly}}
+<form method="post"><input type="hidden" name="transport" value="{{$name}}"><button name="action" value="discover">rediscover</button></form>
+{{- end}}
+</p>
+<table>
+<tr><th>URI</th><th>STATE</th><th>FAILURES</th><th>DEAD SINCE</th><th>REQUESTS</th><th>ERRORS</th><th>LATENCY</th><th>LABELS</th>{{if not $readOnly}}<th></th>{{end}}</tr>
+{{- range .Snapshot.Nodes}}
+<tr{{if .Dead}} class="dead"{{else if .Drained}} class="drained"{{end}}>
+<td>{{.URI}}</td>
+<td>{{if .Dead}}dead{{else if .Drained}}drained{{else}}alive{{end}}</td>
+<td>{{.Failures}}</td>
+<td>{{since .DeadSince}}</td>
+<td>{{.Requests}}</td>
+<td>{{.Errors}}</td>
+<td>{{.Latency.Mean}}</td>
+<td>{{labels .Labels}}</td>
+{{- if not $readOnly}}
+<td>
+<form method="post"><input type="hidden" name="transport" value="{{$name}}"><input type="hidden" name="uri" value="{{.URI}}">
+{{- if .Dead}}<button name="action" value="alive">mark alive</button>{{else}}<button name="action" value="dead">mark dead</button>{{end}}
+{{- if .Drained}}<button name="action" value="undrain">undrain</button>{{else}}<button name="action" value="drain">drain</button>{{end}}
+</form>
+</td>
+{{- end}}
+</tr>
+{{- end}}
+</table>
+{{- with .Events}}
+<table>
+<tr><th>AT</th><th>ACTION</th><th>URI</th><th>ERROR</th></tr>
+{{- range .}}
+<tr><td>{{.At.Format "2006-01-02 15:04:05"}}</td><td>{{.Action}}</td><td>{{.URI}}</td><td class="dead">{{.Error}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- with .Discoveries}}
+<table>
+<tr><th>AT</th><th>DISCOVERY</th><th>ERROR</th></tr>
+{{- range .}}
+<tr><td>{{.At.Format "2006-01-02 15:04:05"}}</td><td>{{.Action}}</td><td class="dead">{{.Error}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- else}}
+<p>There's no registered transport.</p>
+{{- end}}
+</body>
+</html>
+`))
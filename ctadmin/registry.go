@@ -0,0 +1,175 @@
+package ctadmin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+)
+
+// DefaultRegistry is the Registry which is used by Register and Handler
+// without Registry.
+var DefaultRegistry = NewRegistry()
+
+// Register registers t into DefaultRegistry by name.
+func Register(name string, t *ctbase.Transport) {
+	DefaultRegistry.Register(name, t)
+}
+
+// Unregister unregisters the transport of name from DefaultRegistry.
+func Unregister(name string) {
+	DefaultRegistry.Unregister(name)
+}
+
+// Event is a result of an action which was requested by operators, or of a
+// discovery of Transport.
+type Event struct {
+	At     time.Time `json:"at"`
+	Action string    `json:"action"`
+	URI    string    `json:"uri,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// NewRegistry returns Registry which keeps 50 of recent events and
+// discoveries per transport.
+func NewRegistry() *Registry {
+	return &Registry{Events: 50, entries: map[string]*entry{}}
+}
+
+// Registry holds transports which are rendered by Handler.
+type Registry struct {
+	Events int // Default: Keeps 50 of recent events and discoveries per transport
+
+	mu      sync.RWMutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	transport   *ctbase.Transport
+	events      []Event // The newest one is the first
+	discoveries []Event // The newest one is the first
+}
+
+// Register registers t by name, which replaces the transport of the same name.
+func (r *Registry) Register(name string, t *ctbase.Transport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[name] = &entry{transport: t}
+}
+
+// Unregister unregisters the transport of name.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, name)
+}
+
+// Names returns sorted names of registered transports.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Transport returns the transport of name, or nil.
+func (r *Registry) Transport(name string) *ctbase.Transport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if e, ok := r.entries[name]; ok {
+		return e.transport
+	}
+	return nil
+}
+
+// RecentEvents returns recent events of the transport of name, the newest first.
+func (r *Registry) RecentEvents(name string) []Event {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.entries[name]
+	if !ok {
+		return nil
+	}
+	return append([]Event{}, e.events...)
+}
+
+// RecentDiscoveries returns recent discoveries of the transport of name,
+// the newest first, which are recorded by MetricsSink of Metrics.
+func (r *Registry) RecentDiscoveries(name string) []Event {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.entries[name]
+	if !ok {
+		return nil
+	}
+	return append([]Event{}, e.discoveries...)
+}
+
+func (r *Registry) record(name string, ev Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.entries[name]; ok {
+		e.events = r.prepend(e.events, ev)
+	}
+}
+
+func (r *Registry) recordDiscovery(name string, ev Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.entries[name]; ok {
+		e.discoveries = r.prepend(e.discoveries, ev)
+	}
+}
+
+// prepend puts ev in front of events, which drops the oldest ones over Events.
+func (r *Registry) prepend(events []Event, ev Event) []Event {
+	events = append([]Event{ev}, events...)
+	if len(events) > r.Events {
+		events = events[:r.Events]
+	}
+	return events
+}
+
+// Metrics returns MetricsSink which records discoveries of the transport of
+// name, and then passes every metric to next. It's set to Config.Metrics of
+// the transport, whose discoveries are recorded while it's registered.
+func (r *Registry) Metrics(name string, next ctbase.MetricsSink) ctbase.MetricsSink {
+	if next == nil {
+		next = ctbase.NopMetrics{}
+	}
+	return &discoveryMetrics{MetricsSink: next, registry: r, name: name}
+}
+
+// Metrics returns MetricsSink which records discoveries into DefaultRegistry.
+func Metrics(name string, next ctbase.MetricsSink) ctbase.MetricsSink {
+	return DefaultRegistry.Metrics(name, next)
+}
+
+type discoveryMetrics struct {
+	ctbase.MetricsSink
+	registry *Registry
+	name     string
+}
+
+// Discovery records the discovery, and then passes it to the next sink.
+func (m *discoveryMetrics) Discovery(kind string, duration time.Duration, err error) {
+	ev := Event{At: time.Now(), Action: kind}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	m.registry.recordDiscovery(m.name, ev)
+
+	m.MetricsSink.Discovery(kind, duration, err)
+}
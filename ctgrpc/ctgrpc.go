@@ -0,0 +1,256 @@
+// Package ctgrpc bridges Transport into gRPC, which provides a resolver
+// that streams nodes of Transport, and a balancer that picks alive nodes of
+// Transport. Failed RPCs mark the node as dead in Transport, and succeeded
+// RPCs mark it as alive, so that gRPC clients and the rest agree on healthy
+// nodes.
+package ctgrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/grpc/status"
+)
+
+// Name is the name of the resolver scheme and the balancer.
+const Name = "clustertransport"
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(Name, &pickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// ServiceConfig selects the balancer, which is given to grpc.WithDefaultServiceConfig.
+// Resolver sets it as well.
+const ServiceConfig = `{"loadBalancingConfig": [{"` + Name + `": {}}]}`
+
+type transportKey struct{}
+type uriKey struct{}
+
+// NewBuilder returns resolver.Builder which resolves nodes of t. It's
+// given to grpc.WithResolvers, and then a target is `clustertransport:///`.
+func NewBuilder(t *ctbase.Transport) *Builder {
+	return &Builder{Transport: t}
+}
+
+// Builder implements resolver.Builder interface.
+type Builder struct {
+	Transport *ctbase.Transport
+}
+
+// Scheme returns the scheme of the resolver.
+func (b *Builder) Scheme() string {
+	return Name
+}
+
+// Build starts a resolver which is notified of nodes of Transport.
+func (b *Builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &nodeResolver{
+		ts:     b.Transport,
+		cc:     cc,
+		sc:     cc.ParseServiceConfig(ServiceConfig),
+		nodes:  b.Transport.Notify(ctx),
+		now:    make(chan struct{}, 1),
+		cancel: cancel,
+	}
+
+	go r.run()
+	return r, nil
+}
+
+type nodeResolver struct {
+	ts     *ctbase.Transport
+	cc     resolver.ClientConn
+	sc     *serviceconfig.ParseResult
+	nodes  <-chan []string
+	now    chan struct{}
+	cancel context.CancelFunc
+
+	last []string
+}
+
+// ResolveNow reports nodes of Transport again.
+func (r *nodeResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the resolver.
+func (r *nodeResolver) Close() {
+	r.cancel()
+}
+
+func (r *nodeResolver) run() {
+	for {
+		select {
+		case uris, ok := <-r.nodes:
+			if !ok {
+				return
+			}
+			r.update(uris)
+		case <-r.now:
+			if r.last != nil {
+				r.report(r.last)
+			}
+		}
+	}
+}
+
+// update reports nodes to gRPC when they were changed.
+func (r *nodeResolver) update(uris []string) {
+	if r.last != nil && equal(r.last, uris) {
+		return
+	}
+	r.last = uris
+	r.report(uris)
+}
+
+func (r *nodeResolver) report(uris []string) {
+	addrs := make([]resolver.Address, 0, len(uris))
+	for _, uri := range uris {
+		addrs = append(addrs, resolver.Address{
+			Addr: ctbase.Addr(uri),
+			BalancerAttributes: attributes.New(transportKey{}, r.ts).
+				WithValue(uriKey{}, uri),
+		})
+	}
+
+	state := resolver.State{Addresses: addrs}
+	if r.sc != nil && r.sc.Err == nil {
+		state.ServiceConfig = r.sc
+	}
+	if err := r.cc.UpdateState(state); err != nil {
+		r.cc.ReportError(err)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type pickerBuilder struct{}
+
+// Build builds a picker from ready SubConns, which takes health of nodes
+// from Transport at once, so that picking never waits for Transport.
+func (*pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) <= 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &picker{dead: map[string]time.Time{}}
+	for sc, sci := range info.ReadySCs {
+		uri, _ := sci.Address.BalancerAttributes.Value(uriKey{}).(string)
+		ts, _ := sci.Address.BalancerAttributes.Value(transportKey{}).(*ctbase.Transport)
+
+		p.ts = ts
+		p.scs = append(p.scs, sc)
+		p.uris = append(p.uris, uri)
+	}
+
+	if p.ts != nil {
+		s := p.ts.Snapshot()
+		p.resurrect = time.Duration(s.Config.ResurrectAfter) * time.Second
+
+		for _, node := range s.Nodes {
+			if node.Dead || node.Drained {
+				p.dead[node.URI] = node.DeadSince
+			}
+		}
+	}
+
+	return p
+}
+
+// picker picks ready SubConns of alive nodes in round-robin order.
+type picker struct {
+	ts        *ctbase.Transport
+	scs       []balancer.SubConn
+	uris      []string
+	resurrect time.Duration
+
+	mu   sync.Mutex
+	dead map[string]time.Time // Since when nodes are dead
+	next int
+}
+
+// Pick picks a SubConn for a RPC. Dead nodes are tried again after
+// ResurrectAfter of Transport since they died, and all of ready SubConns
+// are picked when all of them are dead. Success of the RPC makes the node
+// alive, and Unavailable makes it dead in Transport.
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	i := p.alive()
+	p.mu.Unlock()
+
+	sc, uri := p.scs[i], p.uris[i]
+
+	return balancer.PickResult{
+		SubConn: sc,
+		Done: func(di balancer.DoneInfo) {
+			if p.ts == nil {
+				return
+			}
+
+			switch {
+			case isNodeFailure(di.Err):
+				p.mu.Lock()
+				p.dead[uri] = time.Now()
+				p.mu.Unlock()
+
+				p.ts.MarkDead(uri)
+			case di.Err == nil:
+				p.mu.Lock()
+				_, dead := p.dead[uri]
+				delete(p.dead, uri)
+				p.mu.Unlock()
+
+				if dead {
+					p.ts.MarkAlive(uri)
+				}
+			}
+		},
+	}, nil
+}
+
+// alive returns index of the next alive node, or of the next node when all
+// of them are dead.
+func (p *picker) alive() int {
+	now := time.Now()
+	for n := 0; n < len(p.scs); n++ {
+		i := (p.next + n) % len(p.scs)
+
+		since, dead := p.dead[p.uris[i]]
+		if !dead || now.Sub(since) >= p.resurrect {
+			p.next = i + 1
+			return i
+		}
+	}
+
+	i := p.next % len(p.scs)
+	p.next++
+	return i
+}
+
+// isNodeFailure reports whether the RPC failed by the node.
+func isNodeFailure(err error) bool {
+	return err != nil && status.Code(err) == codes.Unavailable
+}
@@ -0,0 +1,200 @@
+package ctgrpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// nodes are in-process gRPC servers over bufconn, which are keyed by address.
+type nodes struct {
+	mu        sync.Mutex
+	listeners map[string]*bufconn.Listener
+	servers   map[string]*grpc.Server
+	hits      map[string]int
+	failing   map[string]bool
+}
+
+func newNodes(addrs ...string) *nodes {
+	n := &nodes{
+		listeners: map[string]*bufconn.Listener{},
+		servers:   map[string]*grpc.Server{},
+		hits:      map[string]int{},
+		failing:   map[string]bool{},
+	}
+
+	for _, addr := range addrs {
+		addr := addr
+		lis := bufconn.Listen(1 << 20)
+		srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			n.mu.Lock()
+			n.hits[addr]++
+			failing := n.failing[addr]
+			n.mu.Unlock()
+
+			if failing {
+				return nil, status.Error(codes.Unavailable, "shutting down")
+			}
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(srv, health.NewServer())
+		go srv.Serve(lis)
+
+		n.listeners[addr], n.servers[addr] = lis, srv
+	}
+
+	return n
+}
+
+func (n *nodes) dial(ctx context.Context, addr string) (net.Conn, error) {
+	return n.listeners[addr].DialContext(ctx)
+}
+
+func (n *nodes) stop() {
+	for _, srv := range n.servers {
+		srv.Stop()
+	}
+}
+
+func (n *nodes) counts() map[string]int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	counts := map[string]int{}
+	for k, v := range n.hits {
+		counts[k] = v
+	}
+	return counts
+}
+
+type stubCluster struct{}
+
+func (stubCluster) Sniff(conn *ctbase.Conn) []string      { return nil }
+func (stubCluster) Conn(uri string) (*ctbase.Conn, error) { return &ctbase.Conn{}, nil }
+
+func newTransport(uris ...string) *ctbase.Transport {
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = stubCluster{}
+	cfg.DiscoverOnFailure = false
+	cfg.DiscoverRatio = 0
+	cfg.ResurrectAfter = 1
+	return ctbase.NewTransport(cfg, uris...)
+}
+
+func newClient(t *testing.T, n *nodes, ts *ctbase.Transport) *grpc.ClientConn {
+	cc, err := grpc.NewClient(Name+":///",
+		grpc.WithResolvers(NewBuilder(ts)),
+		grpc.WithContextDialer(n.dial),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	return cc
+}
+
+func check(cc *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	return err
+}
+
+func TestBalancer(t *testing.T) {
+	n := newNodes("node1:50051", "node2:50051")
+	defer n.stop()
+
+	ts := newTransport("node1:50051", "http://node2:50051")
+	cc := newClient(t, n, ts)
+	defer cc.Close()
+
+	// Waits until both of nodes are ready.
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && len(n.counts()) < 2 {
+		assert.NoError(t, check(cc))
+	}
+
+	before := n.counts()
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, check(cc))
+	}
+	after := n.counts()
+	assert.Equal(t, 5, after["node1:50051"]-before["node1:50051"])
+	assert.Equal(t, 5, after["node2:50051"]-before["node2:50051"])
+
+	// Unavailable marks the node as dead in Transport.
+	n.mu.Lock()
+	n.failing["node1:50051"] = true
+	n.mu.Unlock()
+
+	failures := 0
+	for i := 0; i < 10; i++ {
+		if check(cc) != nil {
+			failures++
+		}
+	}
+	assert.Equal(t, 1, failures)
+
+	// Picking nodes isn't counted as requests of Transport.
+	assert.Equal(t, int64(0), ts.Snapshot().Counter)
+	assert.Equal(t, int64(1), ts.Snapshot().Nodes[0].Failures)
+
+	uri, _ := ts.Req(func(conn *ctbase.Conn) (interface{}, error) { return conn.URI, nil })
+	assert.Equal(t, "http://node2:50051", uri)
+
+	// The dead node is tried again after ResurrectAfter, and then success
+	// makes it alive in Transport.
+	n.mu.Lock()
+	n.failing["node1:50051"] = false
+	n.mu.Unlock()
+	time.Sleep(time.Second)
+
+	before = n.counts()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, check(cc))
+	}
+	assert.Equal(t, 2, n.counts()["node1:50051"]-before["node1:50051"])
+	assert.False(t, ts.Snapshot().Nodes[0].Dead)
+}
+
+func TestResolver(t *testing.T) {
+	n := newNodes("node1:50051", "node2:50051")
+	defer n.stop()
+
+	ts := newTransport("node1:50051")
+	cc := newClient(t, n, ts)
+	defer cc.Close()
+
+	assert.NoError(t, check(cc))
+
+	ts.SetNodes("node2:50051")
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		before := n.counts()["node2:50051"]
+		assert.NoError(t, check(cc))
+		if n.counts()["node2:50051"] > before {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	before := n.counts()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, check(cc))
+	}
+	after := n.counts()
+	assert.Equal(t, before["node1:50051"], after["node1:50051"])
+	assert.Equal(t, 3, after["node2:50051"]-before["node2:50051"])
+}
@@ -0,0 +1,83 @@
+// Package ctotel provides ctbase.Tracer which starts OpenTelemetry spans
+// around requests and discoveries of Transport.
+//
+//	cfg := ctbase.NewConfig()
+//	cfg.Tracer = ctotel.New(otel.GetTracerProvider())
+package ctotel
+
+import (
+	"context"
+	"fmt"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of spans.
+const ScopeName = "github.com/ikeikeikeike/clustertransport-base"
+
+// New returns Tracer which starts spans by tp.
+func New(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(ScopeName)}
+}
+
+// Tracer implements ctbase.Tracer interface.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ ctbase.Tracer = (*Tracer)(nil)
+
+// Start starts a span of name as a child of the span in ctx.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, ctbase.Span) {
+	kind := trace.SpanKindInternal
+	if name == ctbase.SpanAttempt {
+		kind = trace.SpanKindClient
+	}
+
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+	return ctx, &Span{span: span}
+}
+
+// Span implements ctbase.Span interface.
+type Span struct {
+	span trace.Span
+}
+
+// SetAttribute sets the attribute, which is converted into a string unless
+// its type is supported by OpenTelemetry.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.span.SetAttributes(attr(key, value))
+}
+
+// End records err, and then ends the span.
+func (s *Span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+func attr(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case []string:
+		return attribute.StringSlice(key, v)
+	case fmt.Stringer:
+		return attribute.String(key, v.String())
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
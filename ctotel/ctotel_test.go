@@ -0,0 +1,89 @@
+package ctotel
+
+import (
+	"context"
+	"testing"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type stubCluster struct{}
+
+func (c *stubCluster) Sniff(conn *ctbase.Conn) []string      { return []string{conn.URI} }
+func (c *stubCluster) Conn(uri string) (*ctbase.Conn, error) { return &ctbase.Conn{}, nil }
+
+func attrs(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = &stubCluster{}
+	cfg.Tracer = New(tp)
+	cfg.Discover = false
+	cfg.MaxRetries = 1
+	ts := ctbase.NewTransport(cfg, "127.0.0.1:1")
+	assert.NoError(t, ts.Discover(context.Background()))
+	exporter.Reset()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "caller")
+	_, err := ts.ReqContext(ctx, func(ctx context.Context, conn *ctbase.Conn) (interface{}, error) {
+		assert.True(t, trace.SpanContextFromContext(ctx).IsValid())
+		return nil, &ctbase.Econnrefused{}
+	})
+	assert.Error(t, err)
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	attempt, req := spans[0], spans[1]
+
+	assert.Equal(t, ctbase.SpanAttempt, attempt.Name)
+	assert.Equal(t, trace.SpanKindClient, attempt.SpanKind)
+	assert.Equal(t, req.SpanContext.SpanID(), attempt.Parent.SpanID())
+	assert.Equal(t, "127.0.0.1:1", attrs(attempt)[ctbase.AttrNode].AsString())
+	assert.Equal(t, int64(0), attrs(attempt)[ctbase.AttrRetry].AsInt64())
+	assert.Equal(t, "connection", attrs(attempt)[ctbase.AttrErrorClass].AsString())
+	assert.Equal(t, codes.Error, attempt.Status.Code)
+	assert.Len(t, attempt.Events, 1, "the error should be recorded")
+
+	assert.Equal(t, ctbase.SpanRequest, req.Name)
+	assert.Equal(t, parent.SpanContext().SpanID(), req.Parent.SpanID())
+
+	// Discovery is traced as a child of the caller.
+	exporter.Reset()
+	ctx, parent = tp.Tracer("test").Start(context.Background(), "caller")
+	assert.NoError(t, ts.Discover(ctx))
+	parent.End()
+
+	names := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		names[s.Name] = s
+	}
+	assert.Equal(t, parent.SpanContext().SpanID(), names[ctbase.SpanDiscovery].Parent.SpanID())
+	assert.Equal(t, names[ctbase.SpanDiscovery].SpanContext.SpanID(), names[ctbase.SpanSniff].Parent.SpanID())
+	assert.Equal(t, "discover", attrs(names[ctbase.SpanDiscovery])[ctbase.AttrKind].AsString())
+}
+
+func TestAttr(t *testing.T) {
+	assert.Equal(t, attribute.String("k", "v"), attr("k", "v"))
+	assert.Equal(t, attribute.Int("k", 1), attr("k", 1))
+	assert.Equal(t, attribute.String("k", "connection"), attr("k", ctbase.ErrorConnection))
+	assert.Equal(t, attribute.String("k", "[1 2]"), attr("k", []int{1, 2}))
+}
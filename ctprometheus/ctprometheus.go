@@ -0,0 +1,150 @@
+// Package ctprometheus provides a Prometheus collector which records metrics
+// of Transport as MetricsSink.
+//
+//	c := ctprometheus.New("memcached")
+//	prometheus.MustRegister(c)
+//	cfg.Metrics = c
+package ctprometheus
+
+import (
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace is a prefix of metric names.
+const Namespace = "clustertransport"
+
+// New returns Collector whose metrics are labeled `transport` by name, so
+// that multiple transports are able to be registered into a registry.
+func New(name string) *Collector {
+	labels := prometheus.Labels{"transport": name}
+
+	return &Collector{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "requests_total", ConstLabels: labels,
+			Help: "Attempts of requests to nodes by error class.",
+		}, []string{"node", "class"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Name: "request_duration_seconds", ConstLabels: labels,
+			Help:    "Latency of attempts of requests to nodes.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"node"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "retries_total", ConstLabels: labels,
+			Help: "Requests which were retried after failures on nodes by error class.",
+		}, []string{"node", "class"}),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "node_transitions_total", ConstLabels: labels,
+			Help: "Nodes which were marked as dead or resurrected.",
+		}, []string{"node", "state"}),
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace, Name: "node_up", ConstLabels: labels,
+			Help: "Whether the node is alive (1) or dead (0).",
+		}, []string{"node"}),
+		discovery: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Name: "discovery_duration_seconds", ConstLabels: labels,
+			Help:    "Duration of discoveries by kind and result.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"kind", "result"}),
+		queue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace, Name: "queue_depth", ConstLabels: labels,
+			Help: "Requests which are waiting for the transport.",
+		}),
+	}
+}
+
+// Collector implements prometheus.Collector and ctbase.MetricsSink interfaces.
+type Collector struct {
+	requests    *prometheus.CounterVec
+	latency     *prometheus.HistogramVec
+	retries     *prometheus.CounterVec
+	transitions *prometheus.CounterVec
+	up          *prometheus.GaugeVec
+	discovery   *prometheus.HistogramVec
+	queue       prometheus.Gauge
+}
+
+var _ ctbase.MetricsSink = (*Collector)(nil)
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.requests, c.latency, c.retries, c.transitions, c.up, c.discovery, c.queue,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.collectors() {
+		m.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.collectors() {
+		m.Collect(ch)
+	}
+}
+
+// Request implements ctbase.MetricsSink.
+func (c *Collector) Request(uri string, latency time.Duration, class ctbase.ErrorClass) {
+	c.requests.WithLabelValues(uri, className(class)).Inc()
+	c.latency.WithLabelValues(uri).Observe(latency.Seconds())
+}
+
+// Retry implements ctbase.MetricsSink.
+func (c *Collector) Retry(uri string, class ctbase.ErrorClass) {
+	c.retries.WithLabelValues(uri, className(class)).Inc()
+}
+
+// NodeDead implements ctbase.MetricsSink.
+func (c *Collector) NodeDead(uri string) {
+	c.transitions.WithLabelValues(uri, "dead").Inc()
+	c.up.WithLabelValues(uri).Set(0)
+}
+
+// NodeAlive implements ctbase.MetricsSink.
+func (c *Collector) NodeAlive(uri string) {
+	c.transitions.WithLabelValues(uri, "alive").Inc()
+	c.up.WithLabelValues(uri).Set(1)
+}
+
+// Discovery implements ctbase.MetricsSink.
+func (c *Collector) Discovery(kind string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	c.discovery.WithLabelValues(kind, result).Observe(duration.Seconds())
+}
+
+// QueueDepth implements ctbase.MetricsSink.
+func (c *Collector) QueueDepth(depth int) {
+	c.queue.Set(float64(depth))
+}
+
+// Nodes implements ctbase.MetricsSink, which sets added nodes up, and
+// deletes series of removed nodes.
+func (c *Collector) Nodes(added, removed []string) {
+	for _, uri := range added {
+		c.up.WithLabelValues(uri).Set(1)
+	}
+
+	for _, uri := range removed {
+		labels := prometheus.Labels{"node": uri}
+		c.requests.DeletePartialMatch(labels)
+		c.latency.DeletePartialMatch(labels)
+		c.retries.DeletePartialMatch(labels)
+		c.transitions.DeletePartialMatch(labels)
+		c.up.DeletePartialMatch(labels)
+	}
+}
+
+func className(class ctbase.ErrorClass) string {
+	if class == ctbase.ErrorNone {
+		return "none"
+	}
+	return string(class)
+}
@@ -0,0 +1,68 @@
+package ctprometheus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCluster struct{}
+
+func (c *stubCluster) Sniff(conn *ctbase.Conn) []string      { return nil }
+func (c *stubCluster) Conn(uri string) (*ctbase.Conn, error) { return &ctbase.Conn{}, nil }
+
+func TestCollector(t *testing.T) {
+	c := New("cache")
+	reg := prometheus.NewPedanticRegistry()
+	assert.NoError(t, reg.Register(c))
+
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = &stubCluster{}
+	cfg.Metrics = c
+	cfg.Discover = false
+	cfg.MaxRetries = 1
+	ts := ctbase.NewTransport(cfg, "127.0.0.1:1")
+
+	// Nodes are up as soon as they're built.
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.up.WithLabelValues("127.0.0.1:1")))
+
+	ts.Req(func(conn *ctbase.Conn) (interface{}, error) { return nil, nil })
+	ts.Req(func(conn *ctbase.Conn) (interface{}, error) { return nil, errors.New("timeout") })
+	ts.MarkDead("127.0.0.1:1")
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP clustertransport_retries_total Requests which were retried after failures on nodes by error class.
+# TYPE clustertransport_retries_total counter
+clustertransport_retries_total{class="other",node="127.0.0.1:1",transport="cache"} 1
+# HELP clustertransport_node_up Whether the node is alive (1) or dead (0).
+# TYPE clustertransport_node_up gauge
+clustertransport_node_up{node="127.0.0.1:1",transport="cache"} 0
+`), "clustertransport_retries_total", "clustertransport_node_up")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.requests.WithLabelValues("127.0.0.1:1", "none")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(c.requests.WithLabelValues("127.0.0.1:1", "other")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.transitions.WithLabelValues("127.0.0.1:1", "dead")))
+	assert.Equal(t, 1, testutil.CollectAndCount(c.latency))
+
+	// Series of removed nodes are deleted.
+	ts.SetNodes("127.0.0.1:2")
+	assert.Equal(t, 0, testutil.CollectAndCount(c.requests))
+	assert.Equal(t, 0, testutil.CollectAndCount(c.latency))
+	assert.Equal(t, 1, testutil.CollectAndCount(c.up))
+	assert.Equal(t, 1.0, testutil.ToFloat64(c.up.WithLabelValues("127.0.0.1:2")))
+
+	d := New("search")
+	d.Discovery("discover", 0, errors.New("nothing"))
+	d.Discovery("discover", 0, nil)
+	d.Discovery("reload", 0, nil)
+	assert.Equal(t, 3, testutil.CollectAndCount(d.discovery))
+
+	// Transports are distinguished by the label.
+	assert.NoError(t, reg.Register(d))
+}
@@ -0,0 +1,147 @@
+// Package ctsql provides driver.Connector which dials one of nodes that's
+// selected by Transport for each new database/sql connection, such as a
+// pool of read-only replicas.
+package ctsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// NewConnector returns Connector which opens connections to nodes of t by drv.
+// Uris of nodes are DSNs as they are, unless DSN is set.
+func NewConnector(t *ctbase.Transport, drv driver.Driver) *Connector {
+	return &Connector{Transport: t, Base: drv, Retries: 2}
+}
+
+// Connector implements driver.Connector interface. Connection-level errors
+// mark the node as dead, and then it dials another node.
+type Connector struct {
+	Transport *ctbase.Transport
+	Base      driver.Driver
+	DSN       func(uri string) string // Default: Uri of the node as it is
+	Retries   int                     // Default: Dials other nodes 2 times
+
+	// Fallback is used when all of nodes are unavailable, such as the primary
+	// for a pool of replicas.
+	Fallback driver.Connector
+
+	// IsConnError reports whether err is a connection-level error.
+	// Default: driver.ErrBadConn and net.Error.
+	IsConnError func(err error) bool
+}
+
+// Connect opens a connection to one of nodes. It's dialed outside of the
+// goroutine which handles requests of Transport, and then the result is
+// reported back to Transport.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	var lastErr error
+
+	for tries := 0; tries <= c.Retries; tries++ {
+		a, err := c.Transport.Acquire(ctx, "")
+		if err != nil {
+			lastErr = err
+			break
+		}
+
+		conn, err := c.open(ctx, a.URI)
+		if err == nil {
+			a.End(nil)
+			return conn, nil
+		}
+		if ctx.Err() != nil || !c.isConnError(err) {
+			a.End(err)
+			return nil, err
+		}
+
+		// Transport marks the node as dead.
+		a.End(ctbase.NewEconnrefused(err))
+		lastErr = errors.Wrapf(err, "Failed to connect to %s", a.URI)
+	}
+
+	if c.Fallback != nil {
+		return c.Fallback.Connect(ctx)
+	}
+	return nil, lastErr
+}
+
+// Driver returns the underlying driver.
+func (c *Connector) Driver() driver.Driver {
+	return c.Base
+}
+
+func (c *Connector) open(ctx context.Context, uri string) (driver.Conn, error) {
+	dsn := uri
+	if c.DSN != nil {
+		dsn = c.DSN(uri)
+	}
+
+	if dc, ok := c.Base.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+
+	return c.Base.Open(dsn)
+}
+
+func (c *Connector) isConnError(err error) bool {
+	if c.IsConnError != nil {
+		return c.IsConnError(err)
+	}
+
+	var ne net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &ne)
+}
+
+// DB is a pair of the primary and a pool of read-only replicas.
+type DB struct {
+	Primary  *sql.DB
+	Replicas *sql.DB
+}
+
+// OpenDB returns DB which opens connections to the primary by primary, and
+// to replicas by replicas. Replicas fall back to the primary when all of
+// them are unavailable.
+func OpenDB(primary driver.Connector, replicas *Connector) *DB {
+	db := &DB{Primary: sql.OpenDB(primary)}
+	if replicas != nil {
+		if replicas.Fallback == nil {
+			replicas.Fallback = primary
+		}
+		db.Replicas = sql.OpenDB(replicas)
+	}
+
+	return db
+}
+
+// Reader returns replicas, or the primary when there's no replica.
+func (db *DB) Reader() *sql.DB {
+	if db.Replicas != nil {
+		return db.Replicas
+	}
+	return db.Primary
+}
+
+// Writer returns the primary.
+func (db *DB) Writer() *sql.DB {
+	return db.Primary
+}
+
+// Close closes both of the primary and replicas.
+func (db *DB) Close() error {
+	err := db.Primary.Close()
+	if db.Replicas != nil {
+		if rerr := db.Replicas.Close(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package ctsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver opens connections which answer DSN to any query.
+type fakeDriver struct {
+	mu     sync.Mutex
+	down   map[string]bool
+	opened map[string]int
+}
+
+var fake = &fakeDriver{down: map[string]bool{}, opened: map[string]int{}}
+
+func init() {
+	sql.Register("ctsql-fake", fake)
+}
+
+func (d *fakeDriver) Open(dsn string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.down[dsn] {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: io.ErrUnexpectedEOF}
+	}
+	if dsn == "invalid" {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	d.opened[dsn]++
+	return &fakeConn{dsn: dsn}, nil
+}
+
+func (d *fakeDriver) reset(down ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.down, d.opened = map[string]bool{}, map[string]int{}
+	for _, dsn := range down {
+		d.down[dsn] = true
+	}
+}
+
+func (d *fakeDriver) counts() map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := map[string]int{}
+	for k, v := range d.opened {
+		counts[k] = v
+	}
+	return counts
+}
+
+type fakeConn struct{ dsn string }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{dsn: c.dsn}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *fakeConn) Commit() error                             { return nil }
+func (c *fakeConn) Rollback() error                           { return nil }
+
+type fakeStmt struct{ dsn string }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{dsn: s.dsn}, nil
+}
+
+type fakeRows struct {
+	dsn  string
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"dsn"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.dsn
+	return nil
+}
+
+type stubCluster struct{}
+
+func (stubCluster) Sniff(conn *ctbase.Conn) []string      { return nil }
+func (stubCluster) Conn(uri string) (*ctbase.Conn, error) { return &ctbase.Conn{}, nil }
+
+func newTransport(uris ...string) *ctbase.Transport {
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = stubCluster{}
+	cfg.DiscoverOnFailure = false
+	cfg.DiscoverRatio = 0
+	return ctbase.NewTransport(cfg, uris...)
+}
+
+func queryDSN(t *testing.T, db *sql.DB) string {
+	var dsn string
+	assert.NoError(t, db.QueryRow("SELECT 1").Scan(&dsn))
+	return dsn
+}
+
+func TestConnector(t *testing.T) {
+	fake.reset("replica2")
+
+	ts := newTransport("replica1", "replica2", "replica3")
+	db := sql.OpenDB(NewConnector(ts, fake))
+	db.SetMaxIdleConns(0)
+	defer db.Close()
+
+	for i := 0; i < 6; i++ {
+		assert.NotEqual(t, "replica2", queryDSN(t, db))
+	}
+	counts := fake.counts()
+	assert.NotContains(t, counts, "replica2")
+	assert.Equal(t, 6, counts["replica1"]+counts["replica3"])
+
+	// The node is dead, so that it's never dialed again.
+	uris := map[interface{}]bool{}
+	for i := 0; i < 4; i++ {
+		uri, _ := ts.Req(func(conn *ctbase.Conn) (interface{}, error) { return conn.URI, nil })
+		uris[uri] = true
+	}
+	assert.Equal(t, map[interface{}]bool{"replica1": true, "replica3": true}, uris)
+
+	// Errors which aren't connection-level are returned as they are.
+	c := NewConnector(newTransport("invalid"), fake)
+	_, err := c.Connect(context.Background())
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// Failures of the node grow over retries, which backs resurrection off.
+	ts = newTransport("replica2")
+	_, err = NewConnector(ts, fake).Connect(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int64(3), ts.Snapshot().Nodes[0].Failures)
+}
+
+func TestConnectorDSN(t *testing.T) {
+	fake.reset()
+
+	c := NewConnector(newTransport("10.0.0.1:5432"), fake)
+	c.DSN = func(uri string) string { return "postgres://app@" + uri + "/reports" }
+
+	conn, err := c.Connect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://app@10.0.0.1:5432/reports", conn.(*fakeConn).dsn)
+}
+
+func TestOpenDB(t *testing.T) {
+	fake.reset("replica1", "replica2")
+
+	primary := NewConnector(newTransport("primary"), fake)
+	db := OpenDB(primary, NewConnector(newTransport("replica1", "replica2"), fake))
+	db.Reader().SetMaxIdleConns(0)
+	defer db.Close()
+
+	assert.Equal(t, "primary", queryDSN(t, db.Writer()))
+
+	// Replicas fall back to the primary when all of them are down.
+	assert.Equal(t, "primary", queryDSN(t, db.Reader()))
+
+	fake.reset()
+	db2 := OpenDB(primary, nil)
+	assert.Equal(t, db2.Primary, db2.Reader())
+	assert.NoError(t, db2.Close())
+}
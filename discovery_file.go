@@ -0,0 +1,378 @@
+package clustertransport
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FileNode is one of node which is written in a discovery file.
+type FileNode struct {
+	URI    string            `json:"uri" yaml:"uri"`
+	Weight int               `json:"weight" yaml:"weight"`
+	Labels map[string]string `json:"labels" yaml:"labels"`
+}
+
+// UnmarshalJSON accepts both of `"host:port"` and `{"uri": "host:port", ...}`.
+func (n *FileNode) UnmarshalJSON(data []byte) error {
+	var uri string
+	if err := json.Unmarshal(data, &uri); err == nil {
+		*n = FileNode{URI: uri}
+		return nil
+	}
+
+	type plain FileNode
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+
+	*n = FileNode(p)
+	return nil
+}
+
+// UnmarshalYAML accepts both of `- host:port` and `- uri: host:port`.
+func (n *FileNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var uri string
+	if err := unmarshal(&uri); err == nil {
+		*n = FileNode{URI: uri}
+		return nil
+	}
+
+	type plain FileNode
+	var p plain
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+
+	*n = FileNode(p)
+	return nil
+}
+
+// NewFileCluster returns FileCluster which reads node uris from path.
+func NewFileCluster(path string, dial func(uri string) (*Conn, error)) *FileCluster {
+	return &FileCluster{
+		Path:     path,
+		Interval: 5 * time.Second,
+		Dial:     dial,
+		Logger:   PrintNothing,
+	}
+}
+
+// FileCluster implements ClusterBase interface which discovers nodes from
+// a JSON, YAML or plain text file instead of asking to cluster system.
+//
+// Plain text file has a node per line, which is able to have weight and labels:
+//
+//	# comment
+//	10.0.0.1:11211 weight=2 zone=a
+//	10.0.0.2:11211
+type FileCluster struct {
+	Path     string
+	Interval time.Duration // Default: Checks the file per 5 sec
+	Dial     func(uri string) (*Conn, error)
+	Logger   func(format string, params ...interface{})
+
+	mu    sync.RWMutex
+	nodes []FileNode
+	sum   [sha1.Size]byte
+	exit  chan struct{}
+}
+
+// Sniff method returns node uris which were read at last successfully.
+func (fc *FileCluster) Sniff(conn *Conn) []string {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+
+	uris := make([]string, 0, len(fc.nodes))
+	for _, node := range fc.nodes {
+		uris = append(uris, node.URI)
+	}
+
+	return uris
+}
+
+// Conn method returns one of cluster system connection with its weight and labels.
+func (fc *FileCluster) Conn(uri string) (*Conn, error) {
+	conn := &Conn{}
+	if fc.Dial != nil {
+		var err error
+		if conn, err = fc.Dial(uri); err != nil {
+			return nil, err
+		}
+	}
+
+	node := fc.node(uri)
+	conn.Weight = node.Weight
+	conn.Labels = node.Labels
+
+	return conn, nil
+}
+
+// Labels method returns labels of the node, which were read at last.
+func (fc *FileCluster) Labels(uri string) map[string]string {
+	return fc.node(uri).Labels
+}
+
+// Weight method returns weight of the node, which was read at last.
+func (fc *FileCluster) Weight(uri string) int {
+	return fc.node(uri).Weight
+}
+
+func (fc *FileCluster) node(uri string) FileNode {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+
+	for _, node := range fc.nodes {
+		if node.URI == uri {
+			return node
+		}
+	}
+
+	return FileNode{}
+}
+
+// Load reads the file and returns node uris. The last good nodes are kept
+// when the file is malformed.
+func (fc *FileCluster) Load() ([]string, error) {
+	if _, err := fc.load(); err != nil {
+		return nil, err
+	}
+
+	return fc.Sniff(nil), nil
+}
+
+// Watch checks the file right away and then per Interval, and rebuilds
+// connections of the Transport when the file was edited.
+func (fc *FileCluster) Watch(t *Transport) {
+	fc.mu.Lock()
+	if fc.exit != nil {
+		fc.mu.Unlock()
+		return
+	}
+	fc.exit = make(chan struct{})
+	fc.mu.Unlock()
+
+	go fc.run(t, fc.exit)
+}
+
+// Exit stops watching the file.
+func (fc *FileCluster) Exit() {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.exit != nil {
+		close(fc.exit)
+		fc.exit = nil
+	}
+}
+
+func (fc *FileCluster) run(t *Transport, exit chan struct{}) {
+	interval := fc.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	// The file is loaded right away, since the Transport may have stale nodes.
+	if !fc.apply(t, exit) {
+		return
+	}
+
+	for {
+		select {
+		case <-tick.C:
+			if !fc.apply(t, exit) {
+				return
+			}
+		case <-exit:
+			return
+		}
+	}
+}
+
+// apply rebuilds connections of the Transport when the file was edited. It
+// reports false when watching was exited while waiting for the Transport.
+func (fc *FileCluster) apply(t *Transport, exit chan struct{}) bool {
+	changed, err := fc.load()
+	if err != nil {
+		fc.logger()("Ignored discovery file %s: %s", fc.Path, err.Error())
+		return true
+	}
+	if !changed {
+		return true
+	}
+
+	// Transport which is busy or stopped mustn't block exiting.
+	done := make(chan struct{})
+	go func() {
+		t.SetNodes(fc.Sniff(nil)...)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-exit:
+		return false
+	}
+}
+
+// load reports whether nodes were replaced by new contents of the file.
+func (fc *FileCluster) load() (bool, error) {
+	data, err := os.ReadFile(fc.Path)
+	if err != nil {
+		return false, errors.Wrap(err, "Failed to read discovery file")
+	}
+
+	sum := sha1.Sum(data)
+
+	fc.mu.RLock()
+	same := sum == fc.sum
+	fc.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	nodes, err := parseFileNodes(fc.Path, data)
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	// Remembers malformed contents as well, so that it's reported only once.
+	fc.sum = sum
+	if err != nil {
+		return false, err
+	}
+
+	fc.nodes = nodes
+	return true, nil
+}
+
+func (fc *FileCluster) logger() func(format string, params ...interface{}) {
+	if fc.Logger == nil {
+		return PrintNothing
+	}
+	return fc.Logger
+}
+
+func parseFileNodes(path string, data []byte) ([]FileNode, error) {
+	var (
+		nodes []FileNode
+		err   error
+	)
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		nodes, err = parseJSONNodes(data)
+	case ".yaml", ".yml":
+		nodes, err = parseYAMLNodes(data)
+	default:
+		nodes, err = parseTextNodes(data)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Malformed discovery file")
+	}
+	if len(nodes) <= 0 {
+		return nil, errors.New("Malformed discovery file: there's no node")
+	}
+
+	seen := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if node.URI == "" {
+			return nil, errors.New("Malformed discovery file: empty uri")
+		}
+		if node.Weight < 0 {
+			return nil, fmt.Errorf("Malformed discovery file: negative weight for %s", node.URI)
+		}
+		if seen[node.URI] {
+			return nil, fmt.Errorf("Malformed discovery file: duplicated uri %s", node.URI)
+		}
+		seen[node.URI] = true
+	}
+
+	return nodes, nil
+}
+
+func parseJSONNodes(data []byte) ([]FileNode, error) {
+	var nodes []FileNode
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err := json.Unmarshal(data, &nodes)
+		return nodes, err
+	}
+
+	var doc struct {
+		Nodes []FileNode `json:"nodes"`
+	}
+	err := json.Unmarshal(data, &doc)
+	return doc.Nodes, err
+}
+
+func parseYAMLNodes(data []byte) ([]FileNode, error) {
+	var nodes []FileNode
+	if err := yaml.Unmarshal(data, &nodes); err == nil {
+		return nodes, nil
+	}
+
+	var doc struct {
+		Nodes []FileNode `yaml:"nodes"`
+	}
+	err := yaml.Unmarshal(data, &doc)
+	return doc.Nodes, err
+}
+
+func parseTextNodes(data []byte) ([]FileNode, error) {
+	var nodes []FileNode
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) <= 0 {
+			continue
+		}
+
+		node := FileNode{URI: fields[0]}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("line %d: invalid attribute %q", line, field)
+			}
+
+			if kv[0] == "weight" {
+				weight, err := strconv.Atoi(kv[1])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid weight %q", line, kv[1])
+				}
+				node.Weight = weight
+				continue
+			}
+
+			if node.Labels == nil {
+				node.Labels = make(map[string]string)
+			}
+			node.Labels[kv[0]] = kv[1]
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	return nodes, scanner.Err()
+}
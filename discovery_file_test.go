@@ -0,0 +1,160 @@
+package clustertransport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileNodes(t *testing.T) {
+	cases := map[string]string{
+		"nodes.json": `[{"uri": "10.0.0.1:11211", "weight": 2, "labels": {"zone": "a"}}, "10.0.0.2:11211"]`,
+		"nodes.yaml": "nodes:\n  - uri: 10.0.0.1:11211\n    weight: 2\n    labels:\n      zone: a\n  - 10.0.0.2:11211\n",
+		"nodes.txt":  "# hosts\n10.0.0.1:11211 weight=2 zone=a\n\n10.0.0.2:11211 # second\n",
+	}
+
+	for name, data := range cases {
+		nodes, err := parseFileNodes(name, []byte(data))
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+
+		assert.Equal(t, []FileNode{
+			{URI: "10.0.0.1:11211", Weight: 2, Labels: map[string]string{"zone": "a"}},
+			{URI: "10.0.0.2:11211"},
+		}, nodes, name)
+	}
+}
+
+func TestParseFileNodesMalformed(t *testing.T) {
+	cases := map[string]string{
+		"empty.txt":     "# nothing\n",
+		"weight.txt":    "10.0.0.1:11211 weight=x\n",
+		"attr.txt":      "10.0.0.1:11211 zone\n",
+		"dup.txt":       "10.0.0.1:11211\n10.0.0.1:11211\n",
+		"broken.json":   `[{"uri": "10.0.0.1:11211"`,
+		"nouri.json":    `[{"weight": 1}]`,
+		"negative.yaml": "- uri: 10.0.0.1:11211\n  weight: -1\n",
+	}
+
+	for name, data := range cases {
+		_, err := parseFileNodes(name, []byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestFileClusterKeepsLastGoodNodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertransport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nodes.txt")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("10.0.0.1:11211 zone=a\n"), 0644))
+
+	fc := NewFileCluster(path, nil)
+	uris, err := fc.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:11211"}, uris)
+
+	conn, err := fc.Conn("10.0.0.1:11211")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", conn.Labels["zone"])
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("10.0.0.1:11211 weight=\n"), 0644))
+	_, err = fc.Load()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"10.0.0.1:11211"}, fc.Sniff(nil))
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("10.0.0.2:11211\n10.0.0.3:11211\n"), 0644))
+	changed, err := fc.load()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, []string{"10.0.0.2:11211", "10.0.0.3:11211"}, fc.Sniff(nil))
+
+	changed, err = fc.load()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
+
+func TestFileClusterWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertransport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nodes.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`["10.0.0.1:11211"]`), 0644))
+
+	fc := NewFileCluster(path, nil)
+	fc.Interval = 10 * time.Millisecond
+	_, err = fc.Load()
+	assert.NoError(t, err)
+
+	cfg := NewConfig()
+	cfg.Cluster = fc
+	ts := NewTransport(cfg, "10.0.0.1:11211")
+
+	fc.Watch(ts)
+	defer fc.Exit()
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"nodes": ["10.0.0.2:11211"]}`), 0644))
+
+	waitURIs(t, ts, []string{"10.0.0.2:11211"})
+}
+
+func TestFileClusterWatchLoadsAtOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertransport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nodes.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`["10.0.0.1:11211"]`), 0644))
+
+	fc := NewFileCluster(path, nil)
+	fc.Interval = time.Hour
+	_, err = fc.Load()
+	assert.NoError(t, err)
+
+	cfg := NewConfig()
+	cfg.Cluster = fc
+	ts := NewTransport(cfg, "10.0.0.1:11211")
+
+	// The file which was edited before watching is applied without waiting for Interval.
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`["10.0.0.2:11211"]`), 0644))
+	fc.Watch(ts)
+	defer fc.Exit()
+
+	waitURIs(t, ts, []string{"10.0.0.2:11211"})
+}
+
+func TestFileClusterReweights(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clustertransport")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nodes.txt")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("10.0.0.1:11211 weight=1\n10.0.0.2:11211\n"), 0644))
+
+	fc := NewFileCluster(path, nil)
+	_, err = fc.Load()
+	assert.NoError(t, err)
+
+	cfg := NewConfig()
+	cfg.Cluster = fc
+	ts := NewTransport(cfg, "10.0.0.1:11211", "10.0.0.2:11211")
+
+	// Reused connections are weighted by the edited file as well.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("10.0.0.1:11211 weight=5\n10.0.0.3:11211\n"), 0644))
+	_, err = fc.Load()
+	assert.NoError(t, err)
+	ts.SetNodes(fc.Sniff(nil)...)
+
+	weights := map[string]int{}
+	for _, node := range ts.Snapshot().Nodes {
+		weights[node.URI] = node.Weight
+	}
+	assert.Equal(t, map[string]int{"10.0.0.1:11211": 5, "10.0.0.3:11211": 0}, weights)
+}
@@ -0,0 +1,266 @@
+// Package elasticsearch implements ClusterBase interface for Elasticsearch,
+// which discovers nodes via `_nodes/http` API.
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// Node is one of Elasticsearch node which was sniffed.
+type Node struct {
+	ID      string
+	Name    string
+	URI     string
+	Version string
+	Roles   []string
+}
+
+// IsMasterOnly reports whether the node is a dedicated master node, which
+// shouldn't receive any requests.
+func (n Node) IsMasterOnly() bool {
+	master := false
+	for _, role := range n.Roles {
+		switch role {
+		case "master":
+			master = true
+		case "voting_only":
+		default:
+			return false
+		}
+	}
+
+	return master
+}
+
+// New returns Cluster which builds clients via newClient.
+func New(newClient func(uri string) (interface{}, error)) *Cluster {
+	return &Cluster{
+		NewClient:  newClient,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Cluster implements ClusterBase interface for Elasticsearch.
+type Cluster struct {
+	Scheme     string // Default: Follows scheme of the uri which is sniffed via
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+	NewClient  func(uri string) (interface{}, error)
+
+	// RewriteAddress rewrites publish address, such as "10.0.0.1:9200" into
+	// the address which is reachable from this host.
+	RewriteAddress func(addr string) string
+
+	mu    sync.RWMutex
+	nodes map[string]Node
+}
+
+// Sniff method returns node connection strings.
+func (c *Cluster) Sniff(conn *ctbase.Conn) []string {
+	return c.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method returns node connection strings except master only nodes.
+func (c *Cluster) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	nodes, err := c.Nodes(ctx, conn.URI)
+	if err != nil {
+		return []string{}
+	}
+
+	sniffed := make(map[string]Node, len(nodes))
+	uris := []string{}
+
+	for _, node := range nodes {
+		if node.IsMasterOnly() {
+			continue
+		}
+
+		sniffed[node.URI] = node
+		uris = append(uris, node.URI)
+	}
+
+	c.mu.Lock()
+	c.nodes = sniffed
+	c.mu.Unlock()
+
+	return uris
+}
+
+// Conn method returns one of cluster system connection.
+func (c *Cluster) Conn(uri string) (*ctbase.Conn, error) {
+	return c.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection which is
+// labeled by node's name, version and roles.
+func (c *Cluster) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn := &ctbase.Conn{}
+	if c.NewClient != nil {
+		client, err := c.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build elasticsearch client")
+		}
+		conn.Client = client
+	}
+
+	c.mu.RLock()
+	node, ok := c.nodes[uri]
+	c.mu.RUnlock()
+
+	if ok {
+		conn.Labels = map[string]string{
+			"id":      node.ID,
+			"name":    node.Name,
+			"version": node.Version,
+			"roles":   strings.Join(node.Roles, ","),
+		}
+	}
+
+	return conn, nil
+}
+
+// Nodes requests `_nodes/http` API via uri, and returns all of nodes which
+// has http publish address.
+func (c *Cluster) Nodes(ctx context.Context, uri string) ([]Node, error) {
+	req, err := http.NewRequest("GET", strings.TrimRight(uri, "/")+"/_nodes/http", nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to sniff via %s: %s", uri, resp.Status)
+	}
+
+	var info nodesInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode _nodes/http")
+	}
+
+	scheme := c.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if u, err := url.Parse(uri); err == nil && u.Scheme != "" {
+			scheme = u.Scheme
+		}
+	}
+
+	ids := make([]string, 0, len(info.Nodes))
+	for id := range info.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	nodes := make([]Node, 0, len(ids))
+	for _, id := range ids {
+		ni := info.Nodes[id]
+		if ni.HTTP == nil {
+			continue
+		}
+
+		addr := publishAddress(ni.HTTP.PublishAddress)
+		if addr == "" {
+			continue
+		}
+		if c.RewriteAddress != nil {
+			addr = c.RewriteAddress(addr)
+		}
+
+		nodes = append(nodes, Node{
+			ID:      id,
+			Name:    ni.Name,
+			URI:     fmt.Sprintf("%s://%s", scheme, addr),
+			Version: ni.Version,
+			Roles:   ni.roles(),
+		})
+	}
+
+	return nodes, nil
+}
+
+type nodesInfo struct {
+	Nodes map[string]*nodeInfo `json:"nodes"`
+}
+
+type nodeInfo struct {
+	Name       string            `json:"name"`
+	Version    string            `json:"version"`
+	Roles      []string          `json:"roles"`      // Elasticsearch 5.x or later
+	Attributes map[string]string `json:"attributes"` // Elasticsearch 2.x
+	HTTP       *struct {
+		PublishAddress string `json:"publish_address"`
+	} `json:"http"`
+}
+
+func (ni *nodeInfo) roles() []string {
+	if ni.Roles != nil {
+		return ni.Roles
+	}
+
+	// Elasticsearch 2.x has roles in attributes, which are true by default.
+	roles := []string{}
+	if ni.Attributes["master"] != "false" {
+		roles = append(roles, "master")
+	}
+	if ni.Attributes["data"] != "false" {
+		roles = append(roles, "data")
+	}
+	if ni.Attributes["client"] == "true" {
+		roles = []string{}
+	}
+
+	return roles
+}
+
+// publishAddress normalizes publish address which is formatted as
+// "ip:port", "hostname/ip:port" or "inet[/ip:port]".
+func publishAddress(addr string) string {
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "inet["), "]")
+
+	if i := strings.Index(addr, "/"); i >= 0 {
+		host, ipport := addr[:i], addr[i+1:]
+		if host == "" {
+			return ipport
+		}
+
+		_, port, err := net.SplitHostPort(ipport)
+		if err != nil {
+			return ipport
+		}
+		return net.JoinHostPort(host, port)
+	}
+
+	return addr
+}
@@ -0,0 +1,107 @@
+package elasticsearch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+func newServer(t *testing.T, tls bool, payload string) *httptest.Server {
+	data, err := ioutil.ReadFile("testdata/" + payload)
+	assert.NoError(t, err)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); ok && (user != "elastic" || pass != "changeme") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/_nodes/http" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	})
+
+	if tls {
+		return httptest.NewTLSServer(handler)
+	}
+	return httptest.NewServer(handler)
+}
+
+func TestSniff7(t *testing.T) {
+	ts := newServer(t, false, "nodes_http_7.json")
+	defer ts.Close()
+
+	c := New(nil)
+	uris := c.Sniff(&ctbase.Conn{URI: ts.URL})
+	assert.Equal(t, []string{"http://172.18.0.2:9200", "http://es02.internal:9200"}, uris)
+
+	conn, err := c.Conn("http://es02.internal:9200")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"id":      "aZ1fV3ubTR6LmjTAf3OrdQ",
+		"name":    "es02",
+		"version": "7.10.2",
+		"roles":   "data,ingest",
+	}, conn.Labels)
+}
+
+func TestSniff2(t *testing.T) {
+	ts := newServer(t, false, "nodes_http_2.json")
+	defer ts.Close()
+
+	c := New(nil)
+	assert.Equal(t, []string{"http://127.0.0.1:9200"}, c.Sniff(&ctbase.Conn{URI: ts.URL}))
+}
+
+func TestSniffHTTPSWithBasicAuth(t *testing.T) {
+	ts := newServer(t, true, "nodes_http_7.json")
+	defer ts.Close()
+
+	c := New(nil)
+	c.HTTPClient = ts.Client()
+
+	c.Username, c.Password = "elastic", "wrong"
+	assert.Empty(t, c.Sniff(&ctbase.Conn{URI: ts.URL}))
+
+	c.Password = "changeme"
+	c.RewriteAddress = func(addr string) string {
+		return strings.Replace(addr, "172.18.0.2", "es01.example.com", 1)
+	}
+
+	uris := c.Sniff(&ctbase.Conn{URI: ts.URL})
+	assert.Equal(t, []string{"https://es01.example.com:9200", "https://es02.internal:9200"}, uris)
+}
+
+func TestConnClientFactory(t *testing.T) {
+	c := New(func(uri string) (interface{}, error) {
+		return "client for " + uri, nil
+	})
+
+	conn, err := c.Conn("http://127.0.0.1:9200")
+	assert.NoError(t, err)
+	assert.Equal(t, "client for http://127.0.0.1:9200", conn.Client)
+	assert.Nil(t, conn.Labels)
+}
+
+func TestPublishAddress(t *testing.T) {
+	cases := map[string]string{
+		"127.0.0.1:9200":                    "127.0.0.1:9200",
+		"es01.internal/172.18.0.2:9200":     "es01.internal:9200",
+		"/172.18.0.2:9200":                  "172.18.0.2:9200",
+		"inet[/127.0.0.1:9200]":             "127.0.0.1:9200",
+		"inet[es01.internal/10.0.0.1:9200]": "es01.internal:9200",
+		"[::1]:9200":                        "[::1]:9200",
+	}
+
+	for addr, want := range cases {
+		assert.Equal(t, want, publishAddress(addr), addr)
+	}
+}
@@ -0,0 +1,248 @@
+// Package httpjson implements ClusterBase interface for services which
+// expose their members as JSON over HTTP, such as `/members` or `/nodes`
+// endpoints. The shape of JSON is described by gjson paths, see
+// https://github.com/tidwall/gjson/blob/master/SYNTAX.md
+package httpjson
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+	"github.com/tidwall/gjson"
+)
+
+// Node is a node which is extracted from JSON, that's passed to URI template.
+type Node struct {
+	Address string
+	Host    string
+	Port    string
+	Weight  int
+	Labels  map[string]string
+}
+
+// New returns Cluster which fetches path from a node, extracts nodes by
+// nodes path and their addresses by address path, and builds clients via
+// newClient.
+func New(path, nodes, address string, newClient func(uri string) (interface{}, error)) *Cluster {
+	return &Cluster{
+		Path:       path,
+		Nodes:      nodes,
+		Address:    address,
+		NewClient:  newClient,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Cluster implements ClusterBase, LabelBase and WeightBase interfaces which is configured
+// by gjson paths. For instance, it extracts "10.0.0.1:8080" and a label
+// "zone": "a" from `{"members": [{"addr": "10.0.0.1:8080", "meta": {"zone": "a"}}]}`
+// by Nodes "members", Address "addr" and LabelPaths {"zone": "meta.zone"}.
+type Cluster struct {
+	Path       string            // Path which is appended to uri of the node, or an absolute URL
+	Nodes      string            // Path to array of nodes. Default: The document itself
+	Address    string            // Path to address in a node. Default: The node itself
+	WeightPath string            // Path to weight in a node. Default: No weight
+	LabelPaths map[string]string // Paths to labels in a node, which are keyed by label name
+	Template   string            // text/template which builds uri from Node. Default: Address as it is
+	Header     http.Header
+	NewClient  func(uri string) (interface{}, error)
+	HTTPClient *http.Client
+
+	mu    sync.RWMutex
+	nodes map[string]Node
+}
+
+// Sniff method returns node connection strings.
+func (c *Cluster) Sniff(conn *ctbase.Conn) []string {
+	return c.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method fetches JSON, and then returns uris of nodes.
+func (c *Cluster) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	data, err := c.fetch(ctx, conn.URI)
+	if err != nil {
+		return []string{}
+	}
+
+	uris, nodes, err := c.Parse(data)
+	if err != nil || len(uris) <= 0 {
+		return []string{}
+	}
+
+	c.mu.Lock()
+	c.nodes = nodes
+	c.mu.Unlock()
+
+	return uris
+}
+
+// Conn method returns one of cluster system connection.
+func (c *Cluster) Conn(uri string) (*ctbase.Conn, error) {
+	return c.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection with its
+// weight and labels.
+func (c *Cluster) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	node := c.nodes[uri]
+	c.mu.RUnlock()
+
+	conn := &ctbase.Conn{Weight: node.Weight, Labels: node.Labels}
+	if c.NewClient != nil {
+		client, err := c.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build client")
+		}
+		conn.Client = client
+	}
+
+	return conn, nil
+}
+
+// Labels method returns labels of the node, which were extracted at last.
+func (c *Cluster) Labels(uri string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.nodes[uri].Labels
+}
+
+// Weight method returns weight of the node, which was extracted at last.
+func (c *Cluster) Weight(uri string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.nodes[uri].Weight
+}
+
+func (c *Cluster) fetch(ctx context.Context, uri string) ([]byte, error) {
+	target := c.Path
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		if !strings.Contains(uri, "://") {
+			uri = "http://" + uri
+		}
+		target = strings.TrimRight(uri, "/") + "/" + strings.TrimLeft(target, "/")
+	}
+
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range c.Header {
+		req.Header[k] = vs
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("Failed to request %s: %s", target, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// Parse extracts nodes from JSON, which returns uris in order of the
+// document and nodes which are keyed by uri.
+func (c *Cluster) Parse(data []byte) ([]string, map[string]Node, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, nil, errors.New("Malformed JSON")
+	}
+
+	var tmpl *template.Template
+	if c.Template != "" {
+		var err error
+		if tmpl, err = template.New("uri").Option("missingkey=zero").Parse(c.Template); err != nil {
+			return nil, nil, errors.Wrap(err, "Malformed URI template")
+		}
+	}
+
+	doc := gjson.ParseBytes(data)
+	if c.Nodes != "" {
+		doc = doc.Get(c.Nodes)
+	}
+
+	nodes := make(map[string]Node)
+	var uris []string
+
+	var err error
+	doc.ForEach(func(_, v gjson.Result) bool {
+		node := c.node(v)
+		if node.Address == "" {
+			return true
+		}
+
+		uri := node.Address
+		if tmpl != nil {
+			var buf bytes.Buffer
+			if err = tmpl.Execute(&buf, node); err != nil {
+				return false
+			}
+			uri = buf.String()
+		}
+
+		if _, ok := nodes[uri]; !ok {
+			nodes[uri] = node
+			uris = append(uris, uri)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to build uri")
+	}
+
+	return uris, nodes, nil
+}
+
+func (c *Cluster) node(v gjson.Result) Node {
+	addr := v
+	if c.Address != "" {
+		addr = v.Get(c.Address)
+	}
+
+	node := Node{Address: addr.String()}
+	if host, port, err := net.SplitHostPort(node.Address); err == nil {
+		node.Host, node.Port = host, port
+	} else {
+		node.Host = node.Address
+	}
+
+	if c.WeightPath != "" {
+		node.Weight = int(v.Get(c.WeightPath).Int())
+	}
+
+	if len(c.LabelPaths) > 0 {
+		node.Labels = make(map[string]string, len(c.LabelPaths))
+		for name, path := range c.LabelPaths {
+			if r := v.Get(path); r.Exists() {
+				node.Labels[name] = r.String()
+			}
+		}
+	}
+
+	return node
+}
@@ -0,0 +1,87 @@
+package httpjson
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+const members = `{
+  "members": [
+    {"addr": "10.0.0.1:7000", "weight": 2, "meta": {"zone": "a"}, "status": "alive"},
+    {"addr": "10.0.0.2:7000", "meta": {"zone": "b"}, "status": "left"},
+    {"addr": "10.0.0.3:7000", "meta": {"zone": "b"}, "status": "alive"},
+    {"name": "no address"}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	c := New("/members", "members", "addr", nil)
+	c.WeightPath = "weight"
+	c.LabelPaths = map[string]string{"zone": "meta.zone", "status": "status"}
+
+	uris, nodes, err := c.Parse([]byte(members))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1:7000", "10.0.0.2:7000", "10.0.0.3:7000"}, uris)
+	assert.Equal(t, Node{
+		Address: "10.0.0.1:7000", Host: "10.0.0.1", Port: "7000", Weight: 2,
+		Labels: map[string]string{"zone": "a", "status": "alive"},
+	}, nodes["10.0.0.1:7000"])
+	assert.Equal(t, "left", nodes["10.0.0.2:7000"].Labels["status"])
+
+	// Query filters nodes, and the template builds uris.
+	c.Nodes = `members.#(status!="left")#`
+	c.Template = "http://{{.Host}}:8080/{{.Labels.zone}}"
+	uris, _, err = c.Parse([]byte(members))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://10.0.0.1:8080/a", "http://10.0.0.3:8080/b"}, uris)
+
+	// Array of strings.
+	c = New("", "", "", nil)
+	uris, _, err = c.Parse([]byte(`["a:1", "b:2", "a:1"]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a:1", "b:2"}, uris)
+
+	_, _, err = c.Parse([]byte(`{"members": [`))
+	assert.Error(t, err)
+
+	c.Template = "{{.Host"
+	_, _, err = c.Parse([]byte(`["a:1"]`))
+	assert.Error(t, err)
+}
+
+func TestSniff(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/members" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(members))
+	}))
+	defer ts.Close()
+
+	c := New("/v1/members", "members", "addr", func(uri string) (interface{}, error) { return uri, nil })
+	c.WeightPath = "weight"
+	c.LabelPaths = map[string]string{"zone": "meta.zone"}
+	c.Header = http.Header{"Authorization": {"Bearer token"}}
+
+	uris := c.Sniff(&ctbase.Conn{URI: ts.URL + "/"})
+	assert.Equal(t, []string{"10.0.0.1:7000", "10.0.0.2:7000", "10.0.0.3:7000"}, uris)
+
+	conn, err := c.Conn("10.0.0.1:7000")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, conn.Weight)
+	assert.Equal(t, "10.0.0.1:7000", conn.Client)
+	assert.Equal(t, map[string]string{"zone": "b"}, c.Labels("10.0.0.3:7000"))
+	assert.Equal(t, 2, c.Weight("10.0.0.1:7000"), "reused connections are weighted again")
+
+	// An absolute URL is requested as it is.
+	c.Path = ts.URL + "/v1/members"
+	assert.Len(t, c.Sniff(&ctbase.Conn{URI: "10.0.0.9:7000"}), 3)
+
+	c.Header = nil
+	assert.Empty(t, c.Sniff(&ctbase.Conn{URI: ts.URL}))
+}
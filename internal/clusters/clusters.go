@@ -0,0 +1,167 @@
+// Package clusters builds ClusterBase adapters by name for commands.
+package clusters
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/ikeikeikeike/clustertransport-base/elasticsearch"
+	"github.com/ikeikeikeike/clustertransport-base/httpjson"
+	"github.com/ikeikeikeike/clustertransport-base/kafka"
+	"github.com/ikeikeikeike/clustertransport-base/memcached"
+	"github.com/ikeikeikeike/clustertransport-base/raft"
+	"github.com/ikeikeikeike/clustertransport-base/redis"
+)
+
+// Options are flags which configure adapters.
+type Options struct {
+	Type       string
+	Seeds      string // Comma separated uris
+	File       string
+	MasterName string
+	Path       string
+	Nodes      string
+	Address    string
+	Timeout    time.Duration
+}
+
+// Register registers flags of options into fs.
+func (o *Options) Register(fs *flag.FlagSet) {
+	fs.StringVar(&o.Type, "type", "static", "cluster type: "+strings.Join(Types(), ", "))
+	fs.StringVar(&o.Seeds, "seeds", "", "comma separated seed uris")
+	fs.StringVar(&o.File, "file", "", "discovery file for -type=file")
+	fs.StringVar(&o.MasterName, "master", "mymaster", "master name for -type=redis-sentinel")
+	fs.StringVar(&o.Path, "path", "/members", "endpoint for -type=httpjson")
+	fs.StringVar(&o.Nodes, "nodes", "", "gjson path to nodes for -type=httpjson")
+	fs.StringVar(&o.Address, "address", "", "gjson path to address in a node for -type=httpjson")
+	fs.DurationVar(&o.Timeout, "timeout", 5*time.Second, "timeout of sniffing and dialing")
+}
+
+// SeedURIs returns seed uris, which are given by -seeds flag and args.
+func (o *Options) SeedURIs(args ...string) []string {
+	var uris []string
+	for _, uri := range append(strings.Split(o.Seeds, ","), args...) {
+		if uri = strings.TrimSpace(uri); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+var builders = map[string]func(o *Options, seeds []string) (ctbase.ClusterBase, error){
+	"static": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		return &Static{URIs: seeds}, nil
+	},
+	"file": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		fc := ctbase.NewFileCluster(o.File, nil)
+		if _, err := fc.Load(); err != nil {
+			return nil, err
+		}
+		return fc, nil
+	},
+	"memcached": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		c := memcached.New(nil)
+		c.Timeout = o.Timeout
+		return c, nil
+	},
+	"elasticsearch": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		return elasticsearch.New(nil), nil
+	},
+	"redis-cluster": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		c := redis.NewCluster(nil)
+		c.Timeout = o.Timeout
+		return c, nil
+	},
+	"redis-sentinel": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		s := redis.NewSentinel(o.MasterName, nil, seeds...)
+		s.Timeout = o.Timeout
+		return s, nil
+	},
+	"etcd": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		return raft.New(raft.Etcd{}, nil), nil
+	},
+	"consul": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		return raft.New(raft.Consul{}, nil), nil
+	},
+	"kafka": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		return kafka.New(kafka.WireFetch("clustertransport", o.Timeout), nil), nil
+	},
+	"httpjson": func(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+		return httpjson.New(o.Path, o.Nodes, o.Address, nil), nil
+	},
+}
+
+// Types returns names of supported cluster types.
+func Types() []string {
+	types := make([]string, 0, len(builders))
+	for name := range builders {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New returns the adapter of o.Type.
+func New(o *Options, seeds []string) (ctbase.ClusterBase, error) {
+	build, ok := builders[o.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster type %q: %s", o.Type, strings.Join(Types(), ", "))
+	}
+	return build(o, seeds)
+}
+
+// Watch lets t follow nodes of the cluster which watches them by itself,
+// such as a discovery file which is edited.
+func Watch(cluster ctbase.ClusterBase, t *ctbase.Transport) {
+	if fc, ok := cluster.(*ctbase.FileCluster); ok {
+		fc.Watch(t)
+	}
+}
+
+// Discover sniffs via seeds in order, and then returns uris which are
+// discovered first. Clusters which don't need seeds, such as a discovery
+// file, are sniffed once without seeds.
+func Discover(ctx context.Context, cluster ctbase.ClusterBase, seeds []string) ([]string, error) {
+	if len(seeds) <= 0 {
+		seeds = []string{""}
+	}
+
+	for _, seed := range seeds {
+		var uris []string
+		if cc, ok := cluster.(ctbase.ClusterContextBase); ok {
+			uris = cc.SniffContext(ctx, &ctbase.Conn{URI: seed})
+		} else {
+			uris = cluster.Sniff(&ctbase.Conn{URI: seed})
+		}
+
+		if len(uris) > 0 {
+			return uris, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("there's no node which was discovered via %s", strings.Join(seeds, ", "))
+}
+
+// Static implements ClusterBase interface which never discovers nodes
+// other than URIs.
+type Static struct {
+	URIs []string
+}
+
+// Sniff method returns URIs as they are.
+func (s *Static) Sniff(conn *ctbase.Conn) []string {
+	return s.URIs
+}
+
+// Conn method returns a connection without a client.
+func (s *Static) Conn(uri string) (*ctbase.Conn, error) {
+	return &ctbase.Conn{}, nil
+}
@@ -0,0 +1,49 @@
+package clusters
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	var o Options
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.Register(fs)
+	assert.NoError(t, fs.Parse([]string{"-seeds", "a:1, b:2,", "c:3"}))
+
+	seeds := o.SeedURIs(fs.Args()...)
+	assert.Equal(t, []string{"a:1", "b:2", "c:3"}, seeds)
+
+	o.File = filepath.Join(t.TempDir(), "nodes.txt")
+	assert.NoError(t, ioutil.WriteFile(o.File, []byte("a:1\n"), 0644))
+
+	for _, name := range Types() {
+		o.Type = name
+		cluster, err := New(&o, seeds)
+		assert.NoError(t, err, name)
+		assert.NotNil(t, cluster, name)
+	}
+
+	o.Type = "unknown"
+	_, err := New(&o, seeds)
+	assert.Error(t, err)
+
+	// The discovery file which isn't able to be read is an error.
+	o.Type, o.File = "file", filepath.Join(t.TempDir(), "missing.txt")
+	_, err = New(&o, seeds)
+	assert.Error(t, err)
+}
+
+func TestDiscover(t *testing.T) {
+	uris, err := Discover(context.Background(), &Static{URIs: []string{"a:1"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a:1"}, uris)
+
+	_, err = Discover(context.Background(), &Static{}, []string{"a:1"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,263 @@
+// Package kafka implements ClusterBase interface for Kafka, which discovers
+// brokers and partition leaders from metadata, and routes requests for a
+// topic/partition to its leader.
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// Key returns a key of Transport.ReqKey for the topic/partition.
+func Key(topic string, partition int32) string {
+	return topic + "/" + strconv.Itoa(int(partition))
+}
+
+// New returns Cluster which discovers metadata via fetch, and builds clients
+// via newClient.
+func New(fetch Fetch, newClient func(uri string) (interface{}, error)) *Cluster {
+	return &Cluster{
+		Fetch:     fetch,
+		NewClient: newClient,
+		Timeout:   5 * time.Second,
+		Retries:   3,
+	}
+}
+
+// Cluster implements ClusterBase, LabelBase and KeySelectorBase interfaces
+// for Kafka. It's set to both of Config.Cluster and Config.Selector.
+type Cluster struct {
+	Fetch     Fetch
+	NewClient func(uri string) (interface{}, error)
+	Timeout   time.Duration // Default: Gives up refreshing metadata after 5 sec
+	Retries   int           // Default: Retries a request on the new leader 3 times
+
+	// NotLeader reports whether err means that the broker isn't the leader.
+	// Default: *Error of NOT_LEADER_FOR_PARTITION or LEADER_NOT_AVAILABLE.
+	NotLeader func(err error) bool
+
+	mu       sync.RWMutex
+	brokers  map[string]Broker
+	leaders  map[string]string // Address of the leader per topic/partition
+	selector ctbase.RoundRobinSelector
+}
+
+// Sniff method returns node connection strings.
+func (c *Cluster) Sniff(conn *ctbase.Conn) []string {
+	return c.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method returns addresses of brokers, and then updates partition leaders.
+func (c *Cluster) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	if c.Fetch == nil {
+		return []string{}
+	}
+
+	md, err := c.Fetch(ctx, conn)
+	if err != nil || md == nil || len(md.Brokers) <= 0 {
+		return []string{}
+	}
+
+	brokers := make(map[string]Broker, len(md.Brokers))
+	addrs := make(map[int32]string, len(md.Brokers))
+	uris := []string{}
+
+	for _, b := range md.Brokers {
+		addr := b.Addr()
+		if _, ok := brokers[addr]; ok {
+			continue
+		}
+
+		brokers[addr], addrs[b.ID] = b, addr
+		uris = append(uris, addr)
+	}
+
+	leaders := make(map[string]string, len(md.Partitions))
+	for _, p := range md.Partitions {
+		if addr, ok := addrs[p.Leader]; ok && p.ErrorCode == 0 {
+			leaders[Key(p.Topic, p.ID)] = addr
+		}
+	}
+
+	c.mu.Lock()
+	c.brokers, c.leaders = brokers, leaders
+	c.mu.Unlock()
+
+	return uris
+}
+
+// Conn method returns one of cluster system connection.
+func (c *Cluster) Conn(uri string) (*ctbase.Conn, error) {
+	return c.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection which is
+// labeled by broker id and rack.
+func (c *Cluster) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn := &ctbase.Conn{Labels: c.Labels(uri)}
+	if c.NewClient != nil {
+		client, err := c.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build kafka client")
+		}
+		conn.Client = client
+	}
+
+	return conn, nil
+}
+
+// Labels method returns broker id and rack of the broker.
+func (c *Cluster) Labels(uri string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	b, ok := c.brokers[uri]
+	if !ok {
+		return nil
+	}
+
+	return map[string]string{"broker_id": strconv.Itoa(int(b.ID)), "rack": b.Rack}
+}
+
+// Select method returns one of connection in round-robin order, which is
+// used for requests without key.
+func (c *Cluster) Select(conns []*ctbase.Conn) *ctbase.Conn {
+	return c.selector.Select(conns)
+}
+
+// SelectKey method returns the connection of the leader of key's
+// topic/partition, which is built by Key.
+func (c *Cluster) SelectKey(conns []*ctbase.Conn, key string) *ctbase.Conn {
+	addr := c.leader(key)
+	if addr == "" {
+		return nil
+	}
+
+	for _, conn := range conns {
+		if conn.URI == addr {
+			return conn
+		}
+	}
+
+	return nil
+}
+
+// Leader returns address of the leader of the topic/partition.
+func (c *Cluster) Leader(topic string, partition int32) string {
+	return c.leader(Key(topic, partition))
+}
+
+func (c *Cluster) leader(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.leaders[key]
+}
+
+// Do requests fun to the leader of the topic/partition via Transport. When
+// fun returns NOT_LEADER_FOR_PARTITION, it refreshes metadata via the broker
+// outside of Transport, and then retries the request on the new leader up to
+// Retries times. Transport discovers brokers first when the new leader is
+// an unknown broker.
+func (c *Cluster) Do(ts *ctbase.Transport, topic string, partition int32, fun func(conn *ctbase.Conn) (interface{}, error)) (interface{}, error) {
+	key := Key(topic, partition)
+
+	for tries := 0; ; tries++ {
+		item, err := ts.ReqKey(key, func(conn *ctbase.Conn) (interface{}, error) {
+			item, err := fun(conn)
+			if err != nil && c.notLeader(err) {
+				// Transport would retry the error on the same broker.
+				return &notLeader{conn: &ctbase.Conn{URI: conn.URI, Client: conn.Client}, err: err}, nil
+			}
+			return item, err
+		})
+
+		nl, ok := item.(*notLeader)
+		if !ok {
+			return item, err
+		}
+		if tries >= c.Retries {
+			return nil, nl.err
+		}
+
+		if !c.relead(ts, key, nl.conn) {
+			return nil, nl.err
+		}
+	}
+}
+
+// notLeader is an item which notices NOT_LEADER_FOR_PARTITION to Do.
+type notLeader struct {
+	conn *ctbase.Conn
+	err  error
+}
+
+// relead refreshes metadata, and then reports whether the leader of key is
+// found in nodes of Transport.
+func (c *Cluster) relead(ts *ctbase.Transport, key string, conn *ctbase.Conn) bool {
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	c.refresh(ctx, conn)
+
+	addr := c.leader(key)
+	if addr == "" {
+		return false
+	}
+
+	for _, uri := range ts.Nodes() {
+		if uri == addr {
+			return true
+		}
+	}
+
+	return ts.Discover(ctx) == nil
+}
+
+// refresh updates metadata via the broker of conn, or via other brokers
+// when it's unavailable.
+func (c *Cluster) refresh(ctx context.Context, conn *ctbase.Conn) {
+	if len(c.SniffContext(ctx, conn)) > 0 {
+		return
+	}
+
+	c.mu.RLock()
+	addrs := make([]string, 0, len(c.brokers))
+	for addr := range c.brokers {
+		if addr != conn.URI {
+			addrs = append(addrs, addr)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, addr := range addrs {
+		if len(c.SniffContext(ctx, &ctbase.Conn{URI: addr})) > 0 {
+			return
+		}
+	}
+}
+
+func (c *Cluster) notLeader(err error) bool {
+	if c.NotLeader != nil {
+		return c.NotLeader(err)
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code == ErrNotLeaderForPartition || e.Code == ErrLeaderNotAvailable
+	}
+	return strings.Contains(err.Error(), "NOT_LEADER_FOR_PARTITION")
+}
@@ -0,0 +1,284 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeMetadata builds body of Metadata response for tests.
+func encodeMetadata(version int16, md *Metadata) []byte {
+	var b []byte
+	str := func(s string) {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+		b = append(b, s...)
+	}
+
+	b = binary.BigEndian.AppendUint32(b, uint32(len(md.Brokers)))
+	for _, br := range md.Brokers {
+		b = binary.BigEndian.AppendUint32(b, uint32(br.ID))
+		str(br.Host)
+		b = binary.BigEndian.AppendUint32(b, uint32(br.Port))
+		if version >= 1 {
+			if br.Rack == "" {
+				b = binary.BigEndian.AppendUint16(b, 0xffff)
+			} else {
+				str(br.Rack)
+			}
+		}
+	}
+	if version >= 1 {
+		b = binary.BigEndian.AppendUint32(b, 1)
+	}
+
+	var topics []string
+	byTopic := map[string][]Partition{}
+	for _, p := range md.Partitions {
+		if _, ok := byTopic[p.Topic]; !ok {
+			topics = append(topics, p.Topic)
+		}
+		byTopic[p.Topic] = append(byTopic[p.Topic], p)
+	}
+
+	b = binary.BigEndian.AppendUint32(b, uint32(len(topics)))
+	for _, topic := range topics {
+		b = binary.BigEndian.AppendUint16(b, 0)
+		str(topic)
+		if version >= 1 {
+			b = append(b, 0)
+		}
+
+		b = binary.BigEndian.AppendUint32(b, uint32(len(byTopic[topic])))
+		for _, p := range byTopic[topic] {
+			b = binary.BigEndian.AppendUint16(b, uint16(p.ErrorCode))
+			b = binary.BigEndian.AppendUint32(b, uint32(p.ID))
+			b = binary.BigEndian.AppendUint32(b, uint32(p.Leader))
+			b = binary.BigEndian.AppendUint32(b, 1) // replicas
+			b = binary.BigEndian.AppendUint32(b, uint32(p.Leader))
+			b = binary.BigEndian.AppendUint32(b, 0) // isr
+		}
+	}
+
+	return b
+}
+
+// fakeBroker responds Metadata request (v1) by md.
+type fakeBroker struct {
+	ln net.Listener
+	mu sync.Mutex
+	md *Metadata
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	f := &fakeBroker{ln: ln, md: &Metadata{}}
+	go f.serve()
+	return f
+}
+
+func (f *fakeBroker) set(md *Metadata) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.md = md
+}
+
+func (f *fakeBroker) addr() string {
+	return f.ln.Addr().String()
+}
+
+func (f *fakeBroker) broker(id int32) Broker {
+	host, port, _ := net.SplitHostPort(f.addr())
+	p, _ := strconv.Atoi(port)
+	return Broker{ID: id, Host: host, Port: int32(p), Rack: "r1"}
+}
+
+func (f *fakeBroker) close() {
+	f.ln.Close()
+}
+
+func (f *fakeBroker) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		req := make([]byte, size)
+		if _, err := io.ReadFull(r, req); err != nil {
+			return
+		}
+		if apiKey := binary.BigEndian.Uint16(req); apiKey != 3 {
+			return
+		}
+
+		f.mu.Lock()
+		body := encodeMetadata(1, f.md)
+		f.mu.Unlock()
+
+		resp := append(req[4:8:8], body...) // correlation id
+		conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(resp))), resp...))
+	}
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	md := &Metadata{
+		Brokers: []Broker{{ID: 1, Host: "10.0.0.1", Port: 9092}, {ID: 2, Host: "10.0.0.2", Port: 9092}},
+		Partitions: []Partition{
+			{Topic: "events", ID: 0, Leader: 1},
+			{Topic: "events", ID: 1, Leader: 2},
+			{Topic: "logs", ID: 0, Leader: -1, ErrorCode: ErrLeaderNotAvailable},
+		},
+	}
+
+	got, err := DecodeMetadata(0, encodeMetadata(0, md))
+	assert.NoError(t, err)
+	assert.Equal(t, md, got)
+
+	md.Brokers[0].Rack = "r1"
+	got, err = DecodeMetadata(1, encodeMetadata(1, md))
+	assert.NoError(t, err)
+	assert.Equal(t, md, got)
+
+	data := encodeMetadata(1, md)
+	_, err = DecodeMetadata(1, data[:len(data)-3])
+	assert.Error(t, err)
+
+	_, err = DecodeMetadata(1, []byte{0x7f, 0xff, 0xff, 0xff})
+	assert.Error(t, err)
+
+	_, err = DecodeMetadata(2, data)
+	assert.Error(t, err)
+}
+
+func TestWireFetch(t *testing.T) {
+	f := newFakeBroker(t)
+	defer f.close()
+
+	f.set(&Metadata{
+		Brokers:    []Broker{f.broker(1), {ID: 2, Host: "10.0.0.2", Port: 9092}},
+		Partitions: []Partition{{Topic: "events", ID: 0, Leader: 2}},
+	})
+
+	c := New(WireFetch("test", time.Second), nil)
+	uris := c.Sniff(&ctbase.Conn{URI: f.addr()})
+	assert.Equal(t, []string{f.addr(), "10.0.0.2:9092"}, uris)
+	assert.Equal(t, "10.0.0.2:9092", c.Leader("events", 0))
+	assert.Equal(t, "", c.Leader("events", 1))
+	assert.Equal(t, map[string]string{"broker_id": "1", "rack": "r1"}, c.Labels(f.addr()))
+
+	assert.Empty(t, c.Sniff(&ctbase.Conn{URI: "127.0.0.1:1"}))
+
+	// A huge response is rejected before it's read.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		binary.Write(conn, binary.BigEndian, int32(1<<31-1))
+	}()
+
+	_, err = WireFetch("test", time.Second)(context.Background(), &ctbase.Conn{URI: ln.Addr().String()})
+	assert.EqualError(t, err, "kafka: malformed response size 2147483647")
+}
+
+func TestDo(t *testing.T) {
+	f, f2 := newFakeBroker(t), newFakeBroker(t)
+	defer f.close()
+	defer f2.close()
+
+	// Both of brokers answer the same metadata, since any of them is sniffed.
+	set := func(md *Metadata) {
+		f.set(md)
+		f2.set(md)
+	}
+
+	b1, b2 := f.broker(1), f2.broker(2)
+	set(&Metadata{
+		Brokers:    []Broker{b1, b2},
+		Partitions: []Partition{{Topic: "events", ID: 0, Leader: 2}, {Topic: "events", ID: 1, Leader: 1}},
+	})
+
+	c := New(WireFetch("test", time.Second), nil)
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = c
+	cfg.Selector = c
+	ts := ctbase.NewTransport(cfg, f.addr())
+	assert.NoError(t, ts.Discover(context.Background()))
+
+	uri := func(conn *ctbase.Conn) (interface{}, error) { return conn.URI, nil }
+
+	item, err := c.Do(ts, "events", 0, uri)
+	assert.NoError(t, err)
+	assert.Equal(t, f2.addr(), item)
+
+	item, err = c.Do(ts, "events", 1, uri)
+	assert.NoError(t, err)
+	assert.Equal(t, f.addr(), item)
+
+	// The leader of events/0 moves to broker 1.
+	set(&Metadata{
+		Brokers:    []Broker{b1, b2},
+		Partitions: []Partition{{Topic: "events", ID: 0, Leader: 1}, {Topic: "events", ID: 1, Leader: 1}},
+	})
+
+	var tried []string
+	item, err = c.Do(ts, "events", 0, func(conn *ctbase.Conn) (interface{}, error) {
+		tried = append(tried, conn.URI)
+		if conn.URI != f.addr() {
+			return nil, &Error{Code: ErrNotLeaderForPartition}
+		}
+		return conn.URI, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, f.addr(), item)
+	assert.Equal(t, []string{f2.addr(), f.addr()}, tried)
+	assert.Equal(t, f.addr(), c.Leader("events", 0))
+
+	// The leader moves to a broker which Transport doesn't know yet.
+	b3 := Broker{ID: 3, Host: "10.0.0.3", Port: 9092}
+	set(&Metadata{
+		Brokers:    []Broker{b1, b2, b3},
+		Partitions: []Partition{{Topic: "events", ID: 0, Leader: 3}, {Topic: "events", ID: 1, Leader: 1}},
+	})
+
+	tried = nil
+	item, err = c.Do(ts, "events", 0, func(conn *ctbase.Conn) (interface{}, error) {
+		tried = append(tried, conn.URI)
+		if conn.URI != "10.0.0.3:9092" {
+			return nil, &Error{Code: ErrNotLeaderForPartition}
+		}
+		return conn.URI, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.3:9092", item)
+	assert.Equal(t, []string{f.addr(), "10.0.0.3:9092"}, tried)
+	assert.Contains(t, ts.Nodes(), "10.0.0.3:9092")
+}
@@ -0,0 +1,247 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// Error codes of Kafka protocol which are concerned with partition leaders.
+const (
+	ErrUnknownTopicOrPartition int16 = 3
+	ErrLeaderNotAvailable      int16 = 5
+	ErrNotLeaderForPartition   int16 = 6
+)
+
+// Error is an error code of Kafka protocol.
+type Error struct {
+	Code int16
+}
+
+func (e *Error) Error() string {
+	switch e.Code {
+	case ErrUnknownTopicOrPartition:
+		return "kafka: UNKNOWN_TOPIC_OR_PARTITION"
+	case ErrLeaderNotAvailable:
+		return "kafka: LEADER_NOT_AVAILABLE"
+	case ErrNotLeaderForPartition:
+		return "kafka: NOT_LEADER_FOR_PARTITION"
+	}
+	return fmt.Sprintf("kafka: error code %d", e.Code)
+}
+
+// Broker is one of broker in metadata.
+type Broker struct {
+	ID   int32
+	Host string
+	Port int32
+	Rack string
+}
+
+// Addr returns host:port of the broker.
+func (b Broker) Addr() string {
+	return net.JoinHostPort(b.Host, strconv.Itoa(int(b.Port)))
+}
+
+// Partition is one of partition in metadata. Leader is -1 while a leader
+// election is in progress.
+type Partition struct {
+	Topic     string
+	ID        int32
+	Leader    int32
+	ErrorCode int16
+}
+
+// Metadata is brokers and partitions of Kafka cluster.
+type Metadata struct {
+	Brokers    []Broker
+	Partitions []Partition
+}
+
+// Fetch returns metadata via the broker of conn.
+type Fetch func(ctx context.Context, conn *ctbase.Conn) (*Metadata, error)
+
+// maxResponseSize caps a response as socket.request.max.bytes of brokers does.
+const maxResponseSize = 100 << 20
+
+// WireFetch returns Fetch which sends Metadata request (v1) for all of
+// topics to the broker directly.
+func WireFetch(clientID string, timeout time.Duration) Fetch {
+	return func(ctx context.Context, conn *ctbase.Conn) (*Metadata, error) {
+		deadline, ok := ctx.Deadline()
+		if !ok && timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+
+		d := net.Dialer{Deadline: deadline}
+		nc, err := d.DialContext(ctx, "tcp", conn.URI)
+		if err != nil {
+			return nil, err
+		}
+		defer nc.Close()
+		nc.SetDeadline(deadline)
+
+		const correlationID = 1
+		if _, err := nc.Write(encodeMetadataRequest(1, correlationID, clientID)); err != nil {
+			return nil, err
+		}
+
+		r := bufio.NewReader(nc)
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		if size < 4 || size > maxResponseSize {
+			return nil, fmt.Errorf("kafka: malformed response size %d", size)
+		}
+
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, err
+		}
+		if id := int32(binary.BigEndian.Uint32(body)); id != correlationID {
+			return nil, fmt.Errorf("kafka: unexpected correlation id %d", id)
+		}
+
+		return DecodeMetadata(1, body[4:])
+	}
+}
+
+// encodeMetadataRequest builds Metadata request for all of topics.
+func encodeMetadataRequest(version int16, correlationID int32, clientID string) []byte {
+	const apiKeyMetadata = 3
+
+	var b []byte
+	b = binary.BigEndian.AppendUint16(b, apiKeyMetadata)
+	b = binary.BigEndian.AppendUint16(b, uint16(version))
+	b = binary.BigEndian.AppendUint32(b, uint32(correlationID))
+	b = binary.BigEndian.AppendUint16(b, uint16(len(clientID)))
+	b = append(b, clientID...)
+
+	// Empty array of v0 and null array of v1 mean all of topics.
+	if version == 0 {
+		b = binary.BigEndian.AppendUint32(b, 0)
+	} else {
+		b = binary.BigEndian.AppendUint32(b, 0xffffffff)
+	}
+
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(b))), b...)
+}
+
+// DecodeMetadata decodes body of Metadata response (v0 or v1), which
+// follows the response header.
+func DecodeMetadata(version int16, body []byte) (*Metadata, error) {
+	if version < 0 || version > 1 {
+		return nil, fmt.Errorf("kafka: unsupported metadata version %d", version)
+	}
+
+	d := &decoder{b: body}
+	md := &Metadata{}
+
+	for i, n := 0, d.arrayLen(); i < n && d.err == nil; i++ {
+		b := Broker{ID: d.int32(), Host: d.string(), Port: d.int32()}
+		if version >= 1 {
+			b.Rack = d.string()
+		}
+		md.Brokers = append(md.Brokers, b)
+	}
+	if version >= 1 {
+		d.int32() // controller_id
+	}
+
+	for i, n := 0, d.arrayLen(); i < n && d.err == nil; i++ {
+		d.int16() // topic error_code
+		topic := d.string()
+		if version >= 1 {
+			d.int8() // is_internal
+		}
+
+		for j, m := 0, d.arrayLen(); j < m && d.err == nil; j++ {
+			p := Partition{Topic: topic, ErrorCode: d.int16(), ID: d.int32(), Leader: d.int32()}
+			d.skipInt32Array() // replicas
+			d.skipInt32Array() // isr
+			md.Partitions = append(md.Partitions, p)
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+	return md, nil
+}
+
+// decoder reads big-endian primitives of Kafka protocol, which remembers
+// the first error.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errors.New("kafka: malformed metadata response")
+		return nil
+	}
+
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.next(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.next(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.next(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+// string reads nullable string, which returns "" for null.
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// arrayLen reads length of array, which returns 0 for null.
+func (d *decoder) arrayLen() int {
+	n := d.int32()
+	if n < 0 {
+		return 0
+	}
+	if int(n) > len(d.b) {
+		d.err = errors.New("kafka: malformed metadata response")
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) skipInt32Array() {
+	d.next(d.arrayLen() * 4)
+}
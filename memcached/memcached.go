@@ -0,0 +1,232 @@
+// Package memcached implements ClusterBase interface for memcached clusters
+// which support auto discovery, such as Amazon ElastiCache.
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// New returns Cluster which builds clients via newClient.
+func New(newClient func(uri string) (interface{}, error)) *Cluster {
+	return &Cluster{
+		NewClient: newClient,
+		Timeout:   5 * time.Second,
+		Ping:      true,
+	}
+}
+
+// Cluster implements ClusterBase interface, which sniffs nodes by
+// `config get cluster`, or legacy `get AmazonElastiCache:cluster` command.
+type Cluster struct {
+	NewClient func(uri string) (interface{}, error)
+	Timeout   time.Duration // Default: Gives up a command after 5 sec without context's deadline
+	UseIP     bool          // Default: Connects to nodes via hostname
+	Ping      bool          // Default: Checks a node by `version` command before building a client
+
+	mu     sync.Mutex
+	conns  map[string]*endpoint // Configuration endpoints which are kept alive
+	config *Config
+	uris   []string
+}
+
+type endpoint struct {
+	conn   net.Conn
+	rw     *bufio.ReadWriter
+	legacy bool // Doesn't support `config get cluster`
+}
+
+// Version returns version of cluster configuration which was sniffed at last.
+func (c *Cluster) Version() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.config == nil {
+		return 0
+	}
+	return c.config.Version
+}
+
+// Sniff method returns node connection strings.
+func (c *Cluster) Sniff(conn *ctbase.Conn) []string {
+	return c.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method returns node connection strings. It returns the
+// last result as it is, when version of cluster configuration isn't changed.
+func (c *Cluster) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cfg, err := c.configure(ctx, conn.URI)
+	if err != nil {
+		return []string{}
+	}
+
+	if c.config != nil && c.config.Version == cfg.Version {
+		return c.uris
+	}
+
+	uris := make([]string, 0, len(cfg.Nodes))
+	for _, node := range cfg.Nodes {
+		uris = append(uris, node.Addr(c.UseIP))
+	}
+
+	c.config, c.uris = cfg, uris
+	return uris
+}
+
+// Conn method returns one of cluster system connection.
+func (c *Cluster) Conn(uri string) (*ctbase.Conn, error) {
+	return c.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection, which is
+// checked by `version` command.
+func (c *Cluster) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	if c.Ping {
+		if err := c.ping(ctx, uri); err != nil {
+			return nil, errors.Wrap(err, "Failed to launch memcached")
+		}
+	}
+
+	conn := &ctbase.Conn{}
+	if c.NewClient != nil {
+		client, err := c.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build memcached client")
+		}
+		conn.Client = client
+	}
+
+	return conn, nil
+}
+
+// Close closes connections to configuration endpoints.
+func (c *Cluster) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for uri, ep := range c.conns {
+		ep.conn.Close()
+		delete(c.conns, uri)
+	}
+
+	return nil
+}
+
+// configure asks to configuration endpoint for cluster configuration, which
+// falls back to legacy command when the endpoint doesn't support it.
+func (c *Cluster) configure(ctx context.Context, uri string) (*Config, error) {
+	ep, err := c.endpoint(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := c.command(ctx, ep)
+	if err == errUnsupported && !ep.legacy {
+		ep.legacy = true
+		cfg, err = c.command(ctx, ep)
+	}
+
+	if err != nil && err != errNoConfig && err != errUnsupported {
+		// Connection state is unknown after an error happened.
+		ep.conn.Close()
+		delete(c.conns, uri)
+	}
+
+	return cfg, err
+}
+
+func (c *Cluster) command(ctx context.Context, ep *endpoint) (*Config, error) {
+	ep.conn.SetDeadline(c.deadline(ctx))
+
+	cmd := "config get cluster\r\n"
+	if ep.legacy {
+		cmd = "get AmazonElastiCache:cluster\r\n"
+	}
+
+	if _, err := ep.rw.WriteString(cmd); err != nil {
+		return nil, err
+	}
+	if err := ep.rw.Flush(); err != nil {
+		return nil, err
+	}
+
+	return readConfig(ep.rw.Reader)
+}
+
+func (c *Cluster) endpoint(ctx context.Context, uri string) (*endpoint, error) {
+	if ep, ok := c.conns[uri]; ok {
+		return ep, nil
+	}
+
+	conn, err := c.dial(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	ep := &endpoint{
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}
+
+	if c.conns == nil {
+		c.conns = make(map[string]*endpoint)
+	}
+	c.conns[uri] = ep
+
+	return ep, nil
+}
+
+func (c *Cluster) ping(ctx context.Context, uri string) error {
+	conn, err := c.dial(ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(c.deadline(ctx))
+	if _, err := fmt.Fprint(conn, "version\r\n"); err != nil {
+		return err
+	}
+
+	status, err := readLine(bufio.NewReader(conn))
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(status, "VERSION") {
+		return fmt.Errorf("memcached: unexpected response %q", status)
+	}
+
+	return nil
+}
+
+func (c *Cluster) dial(ctx context.Context, uri string) (net.Conn, error) {
+	if deadline := c.deadline(ctx); !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", uri)
+}
+
+func (c *Cluster) deadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline
+	}
+	if c.Timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.Timeout)
+}
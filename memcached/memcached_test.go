@@ -0,0 +1,186 @@
+package memcached
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer is an in-process memcached which answers auto discovery commands.
+type fakeServer struct {
+	ln      net.Listener
+	mu      sync.Mutex
+	legacy  bool // Answers ERROR to `config get cluster`
+	config  string
+	accepts int
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	s := &fakeServer{ln: ln}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeServer) close() { s.ln.Close() }
+
+func (s *fakeServer) setConfig(version int, nodes string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = fmt.Sprintf("%d\n%s\n", version, nodes)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.accepts++
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		legacy, config := s.legacy, s.config
+		s.mu.Unlock()
+
+		switch strings.TrimSpace(line) {
+		case "version":
+			fmt.Fprint(conn, "VERSION 1.4.34\r\n")
+		case "config get cluster":
+			if legacy {
+				fmt.Fprint(conn, "ERROR\r\n")
+				continue
+			}
+			fmt.Fprintf(conn, "CONFIG cluster 0 %d\r\n%s\r\nEND\r\n", len(config), config)
+		case "get AmazonElastiCache:cluster":
+			fmt.Fprintf(conn, "VALUE AmazonElastiCache:cluster 0 %d\r\n%s\r\nEND\r\n", len(config), config)
+		default:
+			fmt.Fprint(conn, "ERROR\r\n")
+		}
+	}
+}
+
+func TestSniff(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.close()
+	s.setConfig(12, "node1.cache.amazonaws.com|10.0.0.1|11211 node2.cache.amazonaws.com|10.0.0.2|11211")
+
+	c := New(nil)
+	defer c.Close()
+
+	uris := c.Sniff(&ctbase.Conn{URI: s.addr()})
+	assert.Equal(t, []string{"node1.cache.amazonaws.com:11211", "node2.cache.amazonaws.com:11211"}, uris)
+	assert.Equal(t, 12, c.Version())
+
+	// Unchanged version keeps the last result.
+	s.setConfig(12, "node3.cache.amazonaws.com|10.0.0.3|11211")
+	assert.Equal(t, uris, c.Sniff(&ctbase.Conn{URI: s.addr()}))
+
+	s.setConfig(13, "node3.cache.amazonaws.com|10.0.0.3|11211")
+	assert.Equal(t, []string{"node3.cache.amazonaws.com:11211"}, c.Sniff(&ctbase.Conn{URI: s.addr()}))
+	assert.Equal(t, 13, c.Version())
+
+	s.mu.Lock()
+	assert.Equal(t, 1, s.accepts, "configuration endpoint should be reused")
+	s.mu.Unlock()
+}
+
+func TestSniffLegacy(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.close()
+	s.mu.Lock()
+	s.legacy = true
+	s.mu.Unlock()
+	s.setConfig(1, "node1|10.0.0.1|11211")
+
+	c := New(nil)
+	c.UseIP = true
+	defer c.Close()
+
+	assert.Equal(t, []string{"10.0.0.1:11211"}, c.Sniff(&ctbase.Conn{URI: s.addr()}))
+}
+
+func TestSniffUnreachable(t *testing.T) {
+	s := newFakeServer(t)
+	s.close()
+
+	c := New(nil)
+	assert.Empty(t, c.Sniff(&ctbase.Conn{URI: s.addr()}))
+}
+
+func TestConn(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.close()
+
+	c := New(func(uri string) (interface{}, error) {
+		return "client for " + uri, nil
+	})
+
+	conn, err := c.Conn(s.addr())
+	assert.NoError(t, err)
+	assert.Equal(t, "client for "+s.addr(), conn.Client)
+
+	s.close()
+	_, err = c.Conn(s.addr())
+	assert.Error(t, err)
+}
+
+func TestParseConfigMalformed(t *testing.T) {
+	cases := []string{
+		"",
+		"12\n",
+		"x\nnode1|10.0.0.1|11211\n",
+		"12\nnode1|10.0.0.1\n",
+		"12\nnode1|10.0.0.1|port\n",
+		"12\nnode1|10.0.0.1|70000\n",
+		"12\n||11211\n",
+	}
+
+	for _, payload := range cases {
+		_, err := parseConfig([]byte(payload))
+		assert.Error(t, err, payload)
+	}
+}
+
+func TestReadConfigMalformed(t *testing.T) {
+	cases := []string{
+		"ERROR\r\n",
+		"END\r\n",
+		"SERVER_ERROR out of memory\r\n",
+		"CONFIG cluster 0\r\n",
+		"CONFIG cluster 0 -1\r\n",
+		"CONFIG cluster 0 100\r\n12\n",
+		"CONFIG cluster 0 3\r\n12\n\r\nGARBAGE\r\n",
+	}
+
+	for _, resp := range cases {
+		_, err := readConfig(bufio.NewReader(strings.NewReader(resp)))
+		assert.Error(t, err, resp)
+	}
+}
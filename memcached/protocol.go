@@ -0,0 +1,147 @@
+package memcached
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// errUnsupported is returned when the server doesn't know the command.
+	errUnsupported = errors.New("memcached: unsupported command")
+	// errNoConfig is returned when the server has no cluster configuration.
+	errNoConfig = errors.New("memcached: no cluster configuration")
+)
+
+// Node is one of cache node which is written in cluster configuration.
+type Node struct {
+	Host string
+	IP   string
+	Port int
+}
+
+// Addr returns "host:port", or "ip:port" when useIP is true.
+func (n Node) Addr(useIP bool) string {
+	host := n.Host
+	if (useIP && n.IP != "") || host == "" {
+		host = n.IP
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(n.Port))
+}
+
+// Config is a cluster configuration which is returned by auto discovery.
+type Config struct {
+	Version int
+	Nodes   []Node
+}
+
+// readConfig reads a response of `config get cluster` or legacy
+// `get AmazonElastiCache:cluster`, which are formatted as:
+//
+//	CONFIG cluster 0 147\r\n
+//	12\n
+//	host|ip|port host|ip|port\n
+//	\r\n
+//	END\r\n
+func readConfig(r *bufio.Reader) (*Config, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case line == "END":
+		return nil, errNoConfig
+	case line == "ERROR":
+		return nil, errUnsupported
+	case strings.HasPrefix(line, "CLIENT_ERROR"), strings.HasPrefix(line, "SERVER_ERROR"):
+		return nil, fmt.Errorf("memcached: %s", line)
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != 4 || (fields[0] != "CONFIG" && fields[0] != "VALUE") {
+		return nil, fmt.Errorf("memcached: malformed header %q", line)
+	}
+
+	size, err := strconv.Atoi(fields[3])
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("memcached: malformed length %q", fields[3])
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errors.Wrap(err, "memcached: short payload")
+	}
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "END" {
+			break
+		}
+		if line != "" {
+			return nil, fmt.Errorf("memcached: unexpected line %q", line)
+		}
+	}
+
+	return parseConfig(payload)
+}
+
+// parseConfig parses a payload which has version line and nodes line.
+func parseConfig(payload []byte) (*Config, error) {
+	var lines []string
+	for _, line := range strings.Split(string(payload), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("memcached: too few lines in configuration: %d", len(lines))
+	}
+
+	version, err := strconv.Atoi(lines[0])
+	if err != nil {
+		return nil, fmt.Errorf("memcached: malformed version %q", lines[0])
+	}
+
+	cfg := &Config{Version: version}
+	for _, entry := range strings.Fields(lines[1]) {
+		parts := strings.Split(entry, "|")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("memcached: malformed node %q", entry)
+		}
+
+		port, err := strconv.Atoi(parts[2])
+		if err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("memcached: malformed port in %q", entry)
+		}
+		if parts[0] == "" && parts[1] == "" {
+			return nil, fmt.Errorf("memcached: no host in %q", entry)
+		}
+
+		cfg.Nodes = append(cfg.Nodes, Node{Host: parts[0], IP: parts[1], Port: port})
+	}
+
+	if len(cfg.Nodes) <= 0 {
+		return nil, errors.New("memcached: there's no node in configuration")
+	}
+
+	return cfg, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", errors.Wrap(err, "memcached: failed to read response")
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
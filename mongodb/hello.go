@@ -0,0 +1,68 @@
+package mongodb
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Hello is a response of `hello` or legacy `isMaster` command. It's able to
+// be decoded from relaxed Extended JSON of the response.
+type Hello struct {
+	IsWritablePrimary bool              `json:"isWritablePrimary"`
+	IsMaster          bool              `json:"ismaster"`
+	Secondary         bool              `json:"secondary"`
+	ArbiterOnly       bool              `json:"arbiterOnly"`
+	Passive           bool              `json:"passive"`
+	Hidden            bool              `json:"hidden"`
+	SetName           string            `json:"setName"`
+	Hosts             []string          `json:"hosts"`
+	Passives          []string          `json:"passives"`
+	Arbiters          []string          `json:"arbiters"`
+	Primary           string            `json:"primary"`
+	Me                string            `json:"me"`
+	Tags              map[string]string `json:"tags"`
+}
+
+// DecodeHello decodes a response of `hello` or `isMaster` from JSON.
+func DecodeHello(data []byte) (*Hello, error) {
+	h := &Hello{}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// Writable reports whether the member is the primary.
+func (h *Hello) Writable() bool {
+	return h.IsWritablePrimary || h.IsMaster
+}
+
+// Members returns hosts and passives, which are data bearing members.
+// Arbiters are excluded, and hidden members never appear in the lists.
+func (h *Hello) Members() []string {
+	arbiters := make(map[string]bool, len(h.Arbiters))
+	for _, host := range h.Arbiters {
+		arbiters[normalize(host)] = true
+	}
+
+	seen := make(map[string]bool, len(h.Hosts)+len(h.Passives))
+	members := []string{}
+
+	for _, host := range append(append([]string{}, h.Hosts...), h.Passives...) {
+		host = normalize(host)
+		if host == "" || seen[host] || arbiters[host] {
+			continue
+		}
+
+		seen[host] = true
+		members = append(members, host)
+	}
+
+	return members
+}
+
+// normalize lowercases host:port, since hostnames are case-insensitive.
+func normalize(host string) string {
+	return strings.ToLower(strings.TrimSpace(host))
+}
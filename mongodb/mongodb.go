@@ -0,0 +1,166 @@
+// Package mongodb implements ClusterBase interface for MongoDB replica sets,
+// which discovers members by `hello` or `isMaster` command, and labels
+// connections as "role": "primary" or "secondary" with member tags.
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// HelloFunc runs `hello` (or `isMaster`) command on the member of uri.
+type HelloFunc func(ctx context.Context, uri string) (*Hello, error)
+
+// Primary returns a selector which sends requests to the primary, and to
+// secondaries only while the primary is unknown.
+func Primary() *ctbase.LabelSelector {
+	return &ctbase.LabelSelector{Key: "role", Value: "primary"}
+}
+
+// SecondaryPreferred returns a selector which sends requests to secondaries,
+// and to the primary when there's no secondary.
+func SecondaryPreferred() *ctbase.LabelSelector {
+	return &ctbase.LabelSelector{Key: "role", Value: "primary", Avoid: true}
+}
+
+// New returns Cluster which discovers members of setName via hello, and
+// builds clients via newClient. Any replica set is accepted when setName
+// is empty, and then it's pinned to the set which is discovered first.
+func New(setName string, hello HelloFunc, newClient func(uri string) (interface{}, error)) *Cluster {
+	return &Cluster{SetName: setName, Hello: hello, NewClient: newClient}
+}
+
+// Cluster implements ClusterBase and LabelBase interfaces for MongoDB replica sets.
+type Cluster struct {
+	SetName   string
+	Hello     HelloFunc
+	NewClient func(uri string) (interface{}, error)
+
+	mu      sync.RWMutex
+	pinned  string // Set name which is discovered first when SetName is empty
+	primary string
+	tags    map[string]map[string]string
+}
+
+// Sniff method returns node connection strings.
+func (c *Cluster) Sniff(conn *ctbase.Conn) []string {
+	return c.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method returns host:port of data bearing members, and then
+// records the primary.
+func (c *Cluster) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	h, err := c.hello(ctx, conn.URI)
+	if err != nil {
+		return []string{}
+	}
+
+	members := h.Members()
+
+	c.mu.Lock()
+	c.primary = normalize(h.Primary)
+	if h.Writable() && h.Me != "" {
+		c.primary = normalize(h.Me)
+	}
+	c.mu.Unlock()
+
+	return members
+}
+
+// Conn method returns one of cluster system connection.
+func (c *Cluster) Conn(uri string) (*ctbase.Conn, error) {
+	return c.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection, which is
+// rejected when the member is an arbiter, hidden or belongs to other set.
+func (c *Cluster) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	h, err := c.hello(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	if h.ArbiterOnly || h.Hidden {
+		return nil, fmt.Errorf("mongodb: %s is an arbiter or hidden member", uri)
+	}
+
+	c.mu.Lock()
+	if c.tags == nil {
+		c.tags = make(map[string]map[string]string)
+	}
+	c.tags[normalize(uri)] = h.Tags
+	c.mu.Unlock()
+
+	conn := &ctbase.Conn{Labels: c.Labels(uri)}
+	if c.NewClient != nil {
+		client, err := c.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build mongodb client")
+		}
+		conn.Client = client
+	}
+
+	return conn, nil
+}
+
+// Labels method returns role and tags of the member.
+func (c *Cluster) Labels(uri string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	uri = normalize(uri)
+
+	labels := map[string]string{"role": "secondary"}
+	if uri == c.primary {
+		labels["role"] = "primary"
+	}
+	for k, v := range c.tags[uri] {
+		if k != "role" {
+			labels[k] = v
+		}
+	}
+
+	return labels
+}
+
+// PrimaryURI returns host:port of the primary which was discovered at last.
+func (c *Cluster) PrimaryURI() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.primary
+}
+
+// hello runs hello command, and then checks the set name.
+func (c *Cluster) hello(ctx context.Context, uri string) (*Hello, error) {
+	if c.Hello == nil {
+		return nil, errors.New("mongodb: Hello isn't configured")
+	}
+
+	h, err := c.Hello(ctx, uri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to run hello via %s", uri)
+	}
+	if h.SetName == "" {
+		return nil, fmt.Errorf("mongodb: %s isn't a member of replica set", uri)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	want := c.SetName
+	if want == "" {
+		if c.pinned == "" {
+			c.pinned = h.SetName
+		}
+		want = c.pinned
+	}
+	if h.SetName != want {
+		return nil, fmt.Errorf("mongodb: %s belongs to replica set %q, not %q", uri, h.SetName, want)
+	}
+
+	return h, nil
+}
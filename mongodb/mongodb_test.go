@@ -0,0 +1,143 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, name string) *Hello {
+	data, err := ioutil.ReadFile("testdata/" + name)
+	assert.NoError(t, err)
+
+	h, err := DecodeHello(data)
+	assert.NoError(t, err)
+	return h
+}
+
+// recorded answers hello by recorded responses per uri.
+type recorded struct {
+	mu        sync.Mutex
+	responses map[string]*Hello
+}
+
+func newRecorded(t *testing.T) *recorded {
+	return &recorded{responses: map[string]*Hello{
+		"mongo1:27017": decode(t, "hello_primary.json"),
+		"mongo2:27017": decode(t, "hello_secondary.json"),
+		"mongo3:27017": decode(t, "ismaster_passive.json"),
+		"mongo4:27017": decode(t, "hello_arbiter.json"),
+		"mongo5:27017": decode(t, "hello_hidden.json"),
+		"other1:27017": decode(t, "hello_other_set.json"),
+		"single:27017": decode(t, "hello_standalone.json"),
+	}}
+}
+
+func (r *recorded) hello(ctx context.Context, uri string) (*Hello, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.responses[uri]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	copied := *h
+	return &copied, nil
+}
+
+func (r *recorded) failover() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, h := range r.responses {
+		if h.SetName == "rs0" {
+			h.Primary = "mongo2:27017"
+		}
+	}
+	r.responses["mongo1:27017"].IsWritablePrimary = false
+	r.responses["mongo1:27017"].Secondary = true
+	r.responses["mongo2:27017"].IsWritablePrimary = true
+	r.responses["mongo2:27017"].Secondary = false
+}
+
+func TestDecodeHello(t *testing.T) {
+	h := decode(t, "hello_primary.json")
+	assert.True(t, h.Writable())
+	assert.Equal(t, "rs0", h.SetName)
+	assert.Equal(t, map[string]string{"dc": "east", "usage": "production"}, h.Tags)
+	assert.Equal(t, []string{"mongo1:27017", "mongo2:27017", "mongo3:27017"}, h.Members())
+
+	h = decode(t, "ismaster_passive.json")
+	assert.False(t, h.Writable())
+	assert.True(t, h.Passive)
+
+	h = &Hello{Hosts: []string{"Mongo1:27017", "mongo1:27017", "mongo4:27017"}, Arbiters: []string{"MONGO4:27017"}}
+	assert.Equal(t, []string{"mongo1:27017"}, h.Members())
+
+	_, err := DecodeHello([]byte(`{"hosts": "mongo1"}`))
+	assert.Error(t, err)
+}
+
+func TestSniff(t *testing.T) {
+	r := newRecorded(t)
+	c := New("rs0", r.hello, nil)
+
+	uris := c.Sniff(&ctbase.Conn{URI: "mongo2:27017"})
+	assert.Equal(t, []string{"mongo1:27017", "mongo2:27017", "mongo3:27017"}, uris)
+	assert.Equal(t, "mongo1:27017", c.PrimaryURI())
+
+	conn, err := c.Conn("mongo1:27017")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"role": "primary", "dc": "east", "usage": "production"}, conn.Labels)
+
+	conn, err = c.Conn("mongo3:27017")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"role": "secondary"}, conn.Labels)
+
+	for _, uri := range []string{"mongo4:27017", "mongo5:27017", "other1:27017", "single:27017", "down:27017"} {
+		_, err := c.Conn(uri)
+		assert.Error(t, err, uri)
+	}
+
+	assert.Empty(t, c.Sniff(&ctbase.Conn{URI: "other1:27017"}))
+}
+
+func TestSetNamePinned(t *testing.T) {
+	r := newRecorded(t)
+	c := New("", r.hello, nil)
+
+	assert.Len(t, c.Sniff(&ctbase.Conn{URI: "mongo1:27017"}), 3)
+	assert.Empty(t, c.Sniff(&ctbase.Conn{URI: "other1:27017"}))
+	assert.Equal(t, "", c.SetName)
+}
+
+func TestFailover(t *testing.T) {
+	r := newRecorded(t)
+	c := New("rs0", r.hello, func(uri string) (interface{}, error) { return uri, nil })
+
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = c
+	cfg.Selector = Primary()
+	ts := ctbase.NewTransport(cfg, "mongo2:27017", "mongo4:27017", "other1:27017")
+	assert.NoError(t, ts.Discover(context.Background()))
+
+	uri := func(conn *ctbase.Conn) (interface{}, error) { return conn.Client, nil }
+
+	item, err := ts.Req(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "mongo1:27017", item)
+
+	r.failover()
+	assert.NoError(t, ts.Discover(context.Background()))
+
+	for i := 0; i < 3; i++ {
+		item, err = ts.Req(uri)
+		assert.NoError(t, err)
+		assert.Equal(t, "mongo2:27017", item)
+	}
+}
@@ -0,0 +1,151 @@
+// Package raft implements ClusterBase interface for Raft based clusters
+// which expose member list over HTTP/JSON, such as etcd and Consul. It
+// records the leader, and then labels connections as "role": "leader" or
+// "follower", so that requests prefer or avoid the leader.
+package raft
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// Member is one of member in Raft cluster.
+type Member struct {
+	ID      string
+	Name    string
+	URI     string
+	Learner bool // Non-voting member which isn't able to be the leader
+}
+
+// Source fetches member list and the leader's uri via one of member.
+type Source interface {
+	Members(ctx context.Context, client *http.Client, uri string) ([]Member, string, error)
+}
+
+// PreferLeader returns a selector which sends requests to the leader, such
+// as linearizable writes. Followers are used while the leader is unknown.
+func PreferLeader() *ctbase.LabelSelector {
+	return &ctbase.LabelSelector{Key: "role", Value: "leader"}
+}
+
+// AvoidLeader returns a selector which sends requests to followers, so that
+// the leader isn't loaded by reads.
+func AvoidLeader() *ctbase.LabelSelector {
+	return &ctbase.LabelSelector{Key: "role", Value: "leader", Avoid: true}
+}
+
+// New returns Cluster which discovers members via source, and builds
+// clients via newClient.
+func New(source Source, newClient func(uri string) (interface{}, error)) *Cluster {
+	return &Cluster{
+		Source:     source,
+		NewClient:  newClient,
+		HTTPClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Cluster implements ClusterBase and LabelBase interfaces for Raft based clusters.
+type Cluster struct {
+	Source     Source
+	NewClient  func(uri string) (interface{}, error)
+	HTTPClient *http.Client
+	Learners   bool // Default: Learners aren't discovered
+
+	mu      sync.RWMutex
+	members map[string]Member
+	leader  string
+}
+
+// Sniff method returns node connection strings.
+func (c *Cluster) Sniff(conn *ctbase.Conn) []string {
+	return c.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method returns uris of members, and then records the leader.
+func (c *Cluster) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	members, leader, err := c.Source.Members(ctx, client, conn.URI)
+	if err != nil {
+		return []string{}
+	}
+
+	found := make(map[string]Member, len(members))
+	uris := []string{}
+
+	for _, m := range members {
+		if m.URI == "" || (m.Learner && !c.Learners) {
+			continue
+		}
+
+		found[m.URI] = m
+		uris = append(uris, m.URI)
+	}
+
+	c.mu.Lock()
+	c.members, c.leader = found, leader
+	c.mu.Unlock()
+
+	return uris
+}
+
+// Conn method returns one of cluster system connection.
+func (c *Cluster) Conn(uri string) (*ctbase.Conn, error) {
+	return c.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection which is
+// labeled by its role.
+func (c *Cluster) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn := &ctbase.Conn{Labels: c.Labels(uri)}
+	if c.NewClient != nil {
+		client, err := c.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build client")
+		}
+		conn.Client = client
+	}
+
+	return conn, nil
+}
+
+// Labels method returns role and name of the member.
+func (c *Cluster) Labels(uri string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	m, ok := c.members[uri]
+	if !ok {
+		return nil
+	}
+
+	role := "follower"
+	switch {
+	case uri == c.leader:
+		role = "leader"
+	case m.Learner:
+		role = "learner"
+	}
+
+	return map[string]string{"role": role, "id": m.ID, "name": m.Name}
+}
+
+// Leader returns uri of the leader which was discovered at last.
+func (c *Cluster) Leader() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.leader
+}
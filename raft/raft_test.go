@@ -0,0 +1,164 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEtcd struct {
+	mu      sync.Mutex
+	members []map[string]interface{}
+	leader  string
+}
+
+func (f *fakeEtcd) set(leader string, members ...map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.leader, f.members = leader, members
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/cluster/member/list":
+		json.NewEncoder(w).Encode(map[string]interface{}{"members": f.members})
+	case "/v3/maintenance/status":
+		json.NewEncoder(w).Encode(map[string]interface{}{"leader": f.leader})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func member(id, name string, learner bool, urls ...string) map[string]interface{} {
+	return map[string]interface{}{"ID": id, "name": name, "clientURLs": urls, "isLearner": learner}
+}
+
+func TestEtcd(t *testing.T) {
+	f := &fakeEtcd{}
+	f.set("2",
+		member("1", "etcd1", false, "http://10.0.0.1:2379"),
+		member("2", "etcd2", false, "http://10.0.0.2:2379", "http://etcd2:2379"),
+		member("3", "etcd3", true, "http://10.0.0.3:2379"),
+		member("4", "", false),
+	)
+	ts := httptest.NewServer(f)
+	defer ts.Close()
+
+	c := New(Etcd{}, nil)
+	uris := c.Sniff(&ctbase.Conn{URI: ts.URL})
+	assert.Equal(t, []string{"http://10.0.0.1:2379", "http://10.0.0.2:2379"}, uris)
+	assert.Equal(t, "http://10.0.0.2:2379", c.Leader())
+
+	conn, err := c.Conn("http://10.0.0.2:2379")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"role": "leader", "id": "2", "name": "etcd2"}, conn.Labels)
+	assert.Equal(t, "follower", c.Labels("http://10.0.0.1:2379")["role"])
+	assert.Nil(t, c.Labels("http://10.0.0.3:2379"))
+
+	c.Learners = true
+	uris = c.Sniff(&ctbase.Conn{URI: ts.URL})
+	assert.Len(t, uris, 3)
+	assert.Equal(t, "learner", c.Labels("http://10.0.0.3:2379")["role"])
+}
+
+func TestConsul(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/status/peers":
+			fmt.Fprint(w, `["10.0.0.1:8300","10.0.0.2:8300","10.0.0.3:8300"]`)
+		case "/v1/status/leader":
+			fmt.Fprint(w, `"10.0.0.3:8300"`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	c := New(Consul{Port: "8500"}, nil)
+	uris := c.Sniff(&ctbase.Conn{URI: ts.URL})
+	assert.Equal(t, []string{"http://10.0.0.1:8500", "http://10.0.0.2:8500", "http://10.0.0.3:8500"}, uris)
+	assert.Equal(t, "http://10.0.0.3:8500", c.Leader())
+	assert.Equal(t, "leader", c.Labels("http://10.0.0.3:8500")["role"])
+
+	// The port of the seed is used when Port is empty.
+	c = New(Consul{}, nil)
+	uris = c.Sniff(&ctbase.Conn{URI: ts.URL})
+	port := ts.URL[strings.LastIndex(ts.URL, ":")+1:]
+	assert.Equal(t, "http://10.0.0.1:"+port, uris[0])
+}
+
+func TestSniffFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	c := New(Etcd{}, nil)
+	assert.Empty(t, c.Sniff(&ctbase.Conn{URI: ts.URL}))
+}
+
+func TestPreferLeader(t *testing.T) {
+	// Any of members answers the same membership, since any of them is sniffed.
+	f := &fakeEtcd{}
+	ts, ts2, ts3 := httptest.NewServer(f), httptest.NewServer(f), httptest.NewServer(f)
+	defer ts.Close()
+	defer ts2.Close()
+	defer ts3.Close()
+
+	f.set("1",
+		member("1", "etcd1", false, ts.URL),
+		member("2", "etcd2", false, ts2.URL),
+		member("3", "etcd3", false, ts3.URL),
+	)
+
+	c := New(Etcd{}, nil)
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = c
+	cfg.Selector = PreferLeader()
+	tr := ctbase.NewTransport(cfg, ts.URL)
+
+	assert.NoError(t, tr.Discover(context.Background()))
+
+	for i := 0; i < 5; i++ {
+		uri, err := tr.Req(func(conn *ctbase.Conn) (interface{}, error) { return conn.URI, nil })
+		assert.NoError(t, err)
+		assert.Equal(t, ts.URL, uri)
+	}
+
+	// Leader election moves the leader.
+	f.set("3",
+		member("1", "etcd1", false, ts.URL),
+		member("2", "etcd2", false, ts2.URL),
+		member("3", "etcd3", false, ts3.URL),
+	)
+	assert.NoError(t, tr.Discover(context.Background()))
+
+	deadline := time.Now().Add(time.Second)
+	var uri interface{}
+	for time.Now().Before(deadline) {
+		uri, _ = tr.Req(func(conn *ctbase.Conn) (interface{}, error) { return conn.URI, nil })
+		if uri == ts3.URL {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, ts3.URL, uri)
+}
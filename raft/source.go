@@ -0,0 +1,146 @@
+package raft
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// Etcd is Source for etcd v3, which uses `/v3/cluster/member/list` and
+// `/v3/maintenance/status` of gRPC gateway.
+type Etcd struct{}
+
+// Members fetches members, and the leader via member's status.
+func (Etcd) Members(ctx context.Context, client *http.Client, uri string) ([]Member, string, error) {
+	var list struct {
+		Members []struct {
+			ID         string   `json:"ID"`
+			Name       string   `json:"name"`
+			ClientURLs []string `json:"clientURLs"`
+			IsLearner  bool     `json:"isLearner"`
+		} `json:"members"`
+	}
+	if err := postJSON(ctx, client, uri+"/v3/cluster/member/list", &list); err != nil {
+		return nil, "", err
+	}
+
+	var status struct {
+		Leader string `json:"leader"`
+	}
+	if err := postJSON(ctx, client, uri+"/v3/maintenance/status", &status); err != nil {
+		return nil, "", err
+	}
+
+	var (
+		members []Member
+		leader  string
+	)
+	for _, m := range list.Members {
+		// Member which hasn't started yet has no name and client urls.
+		if len(m.ClientURLs) <= 0 {
+			continue
+		}
+
+		member := Member{ID: m.ID, Name: m.Name, URI: m.ClientURLs[0], Learner: m.IsLearner}
+		if m.ID == status.Leader {
+			leader = member.URI
+		}
+		members = append(members, member)
+	}
+
+	return members, leader, nil
+}
+
+// Consul is Source for Consul servers, which uses `/v1/status/peers` and
+// `/v1/status/leader`. Peers are RPC addresses, which are converted into
+// HTTP API's uris with Port, or with the port of the uri which is sniffed via.
+type Consul struct {
+	Port string
+}
+
+// Members fetches peers and the leader.
+func (cs Consul) Members(ctx context.Context, client *http.Client, uri string) ([]Member, string, error) {
+	var peers []string
+	if err := getJSON(ctx, client, uri+"/v1/status/peers", &peers); err != nil {
+		return nil, "", err
+	}
+
+	var leader string
+	if err := getJSON(ctx, client, uri+"/v1/status/leader", &leader); err != nil {
+		return nil, "", err
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	port := cs.Port
+	if port == "" {
+		port = u.Port()
+	}
+
+	toURI := func(peer string) string {
+		host, _, err := net.SplitHostPort(peer)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%s://%s", u.Scheme, net.JoinHostPort(host, port))
+	}
+
+	var members []Member
+	for _, peer := range peers {
+		members = append(members, Member{ID: peer, Name: peer, URI: toURI(peer)})
+	}
+
+	// The leader is "" while election is in progress.
+	if leader != "" {
+		leader = toURI(leader)
+	}
+
+	return members, leader, nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, uri string, v interface{}) error {
+	req, err := http.NewRequest("POST", uri, bytes.NewBufferString("{}"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doJSON(ctx, client, req, v)
+}
+
+func getJSON(ctx context.Context, client *http.Client, uri string, v interface{}) error {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return err
+	}
+
+	return doJSON(ctx, client, req, v)
+}
+
+func doJSON(ctx context.Context, client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("Failed to request %s: %s", req.URL, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "Failed to decode %s", req.URL.Path)
+	}
+
+	return nil
+}
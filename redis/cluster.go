@@ -0,0 +1,340 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// NewCluster returns Cluster which builds clients via newClient.
+func NewCluster(newClient func(uri string) (interface{}, error)) *Cluster {
+	return &Cluster{
+		NewClient: newClient,
+		Timeout:   5 * time.Second,
+		Ping:      true,
+	}
+}
+
+// Cluster implements ClusterBase and KeySelectorBase interfaces for Redis
+// Cluster. It's set to both of Config.Cluster and Config.Selector.
+type Cluster struct {
+	NewClient func(uri string) (interface{}, error)
+	Username  string
+	Password  string
+	Timeout   time.Duration // Default: Gives up a command after 5 sec without context's deadline
+	Ping      bool          // Default: Checks a node by PING command before building a client
+
+	mu       sync.RWMutex
+	slots    [SlotCount]string // Address of the owner per slot
+	selector ctbase.RoundRobinSelector
+}
+
+// Sniff method returns node connection strings.
+func (c *Cluster) Sniff(conn *ctbase.Conn) []string {
+	return c.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method returns addresses of master nodes, and then updates slot map.
+func (c *Cluster) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	rc, err := c.dial(ctx, conn.URI)
+	if err != nil {
+		return []string{}
+	}
+	defer rc.Close()
+
+	host, _, _ := net.SplitHostPort(conn.URI)
+
+	ranges, err := clusterShards(rc, host)
+	if _, ok := err.(respError); ok {
+		ranges, err = clusterSlots(rc, host)
+	}
+	if err != nil || len(ranges) <= 0 {
+		return []string{}
+	}
+
+	var slots [SlotCount]string
+	seen := make(map[string]bool)
+	uris := []string{}
+
+	for _, r := range ranges {
+		for slot := r.start; slot <= r.end; slot++ {
+			slots[slot] = r.addr
+		}
+		if !seen[r.addr] {
+			seen[r.addr] = true
+			uris = append(uris, r.addr)
+		}
+	}
+
+	c.mu.Lock()
+	c.slots = slots
+	c.mu.Unlock()
+
+	return uris
+}
+
+// Conn method returns one of cluster system connection.
+func (c *Cluster) Conn(uri string) (*ctbase.Conn, error) {
+	return c.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection, which is
+// checked by PING command.
+func (c *Cluster) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	if c.Ping {
+		rc, err := c.dial(ctx, uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to launch redis")
+		}
+		defer rc.Close()
+
+		if _, err := rc.do("PING"); err != nil {
+			return nil, errors.Wrap(err, "Failed to launch redis")
+		}
+	}
+
+	conn := &ctbase.Conn{Labels: map[string]string{"role": "primary"}}
+	if c.NewClient != nil {
+		client, err := c.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build redis client")
+		}
+		conn.Client = client
+	}
+
+	return conn, nil
+}
+
+// Select method returns one of connection in round-robin order, which is
+// used for requests without key.
+func (c *Cluster) Select(conns []*ctbase.Conn) *ctbase.Conn {
+	return c.selector.Select(conns)
+}
+
+// SelectKey method returns the connection which owns hash slot of the key.
+func (c *Cluster) SelectKey(conns []*ctbase.Conn, key string) *ctbase.Conn {
+	addr := c.Owner(key)
+	if addr == "" {
+		return nil
+	}
+
+	for _, conn := range conns {
+		if conn.URI == addr {
+			return conn
+		}
+	}
+
+	return nil
+}
+
+// Owner returns address of the node which owns hash slot of the key.
+func (c *Cluster) Owner(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.slots[Slot(key)]
+}
+
+// Redirect converts MOVED and ASK errors into *ctbase.Redirect, which lets
+// Transport retry the request on the node. MOVED updates slot map as well.
+// It returns err as it is when err isn't redirection.
+func (c *Cluster) Redirect(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	kind, slot, addr, ok := parseRedirect(err.Error())
+	if !ok {
+		return err
+	}
+
+	if kind == "MOVED" {
+		c.mu.Lock()
+		c.slots[slot] = addr
+		c.mu.Unlock()
+	}
+
+	return &ctbase.Redirect{URI: addr, Err: err}
+}
+
+// Do requests fun to the owner of key's hash slot via Transport, which
+// follows MOVED and ASK redirections. When asking is true, fun has to send
+// ASKING command before the command.
+func (c *Cluster) Do(ts *ctbase.Transport, key string, fun func(conn *ctbase.Conn, asking bool) (interface{}, error)) (interface{}, error) {
+	// Transport calls it on its own goroutine one by one.
+	var ask string // The node which ASK pointed
+
+	return ts.ReqKey(key, func(conn *ctbase.Conn) (interface{}, error) {
+		// ASKING is sent only to the node which ASK pointed, since Transport
+		// selects another node when the node is unknown, dead or drained.
+		item, err := fun(conn, ask != "" && conn.URI == ask)
+		ask = ""
+
+		err = c.Redirect(err)
+		if r, ok := err.(*ctbase.Redirect); ok && strings.HasPrefix(r.Err.Error(), "ASK ") {
+			ask = r.URI
+		}
+
+		return item, err
+	})
+}
+
+func (c *Cluster) dial(ctx context.Context, addr string) (*respConn, error) {
+	rc, err := dialRESP(ctx, addr, c.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rc.auth(c.Username, c.Password); err != nil {
+		rc.Close()
+		return nil, err
+	}
+
+	return rc, nil
+}
+
+// parseRedirect parses "MOVED 3999 127.0.0.1:6381" or "ASK 3999 127.0.0.1:6381".
+func parseRedirect(msg string) (kind string, slot int, addr string, ok bool) {
+	fields := strings.Fields(msg)
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", 0, "", false
+	}
+
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil || slot < 0 || slot >= SlotCount {
+		return "", 0, "", false
+	}
+
+	return fields[0], slot, fields[2], true
+}
+
+type slotRange struct {
+	start, end int
+	addr       string
+}
+
+// clusterShards parses a reply of `CLUSTER SHARDS` which is supported by Redis 7.0 or later.
+func clusterShards(rc *respConn, host string) ([]slotRange, error) {
+	reply, err := rc.do("CLUSTER", "SHARDS")
+	if err != nil {
+		return nil, err
+	}
+
+	shards, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: malformed CLUSTER SHARDS reply")
+	}
+
+	var ranges []slotRange
+	for _, shard := range shards {
+		fields := pairs(shard)
+
+		var addr string
+		nodes, _ := fields["nodes"].([]interface{})
+		for _, node := range nodes {
+			nf := pairs(node)
+			if nf["role"] != "master" || (nf["health"] != nil && nf["health"] != "online") {
+				continue
+			}
+
+			ip, _ := nf["endpoint"].(string)
+			if ip == "" || ip == "?" {
+				ip, _ = nf["ip"].(string)
+			}
+			if ip == "" {
+				ip = host
+			}
+			// TLS-only nodes have tls-port without port.
+			port, _ := nf["port"].(int64)
+			if port == 0 {
+				port, _ = nf["tls-port"].(int64)
+			}
+			if port == 0 {
+				continue
+			}
+			addr = net.JoinHostPort(ip, strconv.FormatInt(port, 10))
+		}
+		if addr == "" {
+			continue
+		}
+
+		slots, _ := fields["slots"].([]interface{})
+		for i := 0; i+1 < len(slots); i += 2 {
+			start, ok1 := slots[i].(int64)
+			end, ok2 := slots[i+1].(int64)
+			if !ok1 || !ok2 || !validRange(start, end) {
+				return nil, fmt.Errorf("redis: malformed slot range in CLUSTER SHARDS")
+			}
+			ranges = append(ranges, slotRange{start: int(start), end: int(end), addr: addr})
+		}
+	}
+
+	return ranges, nil
+}
+
+// clusterSlots parses a reply of `CLUSTER SLOTS`.
+func clusterSlots(rc *respConn, host string) ([]slotRange, error) {
+	reply, err := rc.do("CLUSTER", "SLOTS")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redis: malformed CLUSTER SLOTS reply")
+	}
+
+	var ranges []slotRange
+	for _, entry := range entries {
+		e, ok := entry.([]interface{})
+		if !ok || len(e) < 3 {
+			return nil, fmt.Errorf("redis: malformed CLUSTER SLOTS entry")
+		}
+
+		start, ok1 := e[0].(int64)
+		end, ok2 := e[1].(int64)
+		master, ok3 := e[2].([]interface{})
+		if !ok1 || !ok2 || !ok3 || len(master) < 2 || !validRange(start, end) {
+			return nil, fmt.Errorf("redis: malformed CLUSTER SLOTS entry")
+		}
+
+		ip, _ := master[0].(string)
+		if ip == "" || ip == "?" {
+			ip = host
+		}
+		port, ok := master[1].(int64)
+		if !ok {
+			return nil, fmt.Errorf("redis: malformed port in CLUSTER SLOTS")
+		}
+
+		addr := net.JoinHostPort(ip, strconv.FormatInt(port, 10))
+		ranges = append(ranges, slotRange{start: int(start), end: int(end), addr: addr})
+	}
+
+	return ranges, nil
+}
+
+func validRange(start, end int64) bool {
+	return 0 <= start && start <= end && end < SlotCount
+}
+
+// pairs converts a flat array of key and value into a map.
+func pairs(v interface{}) map[string]interface{} {
+	items, _ := v.([]interface{})
+
+	m := make(map[string]interface{}, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		if key, ok := items[i].(string); ok {
+			m[key] = items[i+1]
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,192 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+func slotsReply(ranges ...[3]string) string {
+	reply := fmt.Sprintf("*%d\r\n", len(ranges))
+	for _, r := range ranges {
+		host, port, _ := net.SplitHostPort(r[2])
+		reply += fmt.Sprintf("*3\r\n:%s\r\n:%s\r\n*3\r\n%s:%s\r\n%s", r[0], r[1], bulk(host), port, bulk("node-"+port))
+	}
+	return reply
+}
+
+func shardsReply(ranges ...[3]string) string {
+	reply := fmt.Sprintf("*%d\r\n", len(ranges))
+	for _, r := range ranges {
+		host, port, _ := net.SplitHostPort(r[2])
+		reply += "*4\r\n" + bulk("slots") + fmt.Sprintf("*2\r\n:%s\r\n:%s\r\n", r[0], r[1]) +
+			bulk("nodes") + "*1\r\n*10\r\n" +
+			bulk("id") + bulk("node-"+port) +
+			bulk("port") + ":" + port + "\r\n" +
+			bulk("ip") + bulk(host) +
+			bulk("role") + bulk("master") +
+			bulk("health") + bulk("online")
+	}
+	return reply
+}
+
+func TestSlot(t *testing.T) {
+	assert.Equal(t, 12739, Slot("123456789"))
+	assert.Equal(t, 12182, Slot("foo"))
+	assert.Equal(t, 5061, Slot("bar"))
+	assert.Equal(t, Slot("user1000"), Slot("{user1000}.following"))
+	assert.Equal(t, Slot("{user1000}.followers"), Slot("{user1000}.following"))
+	assert.Equal(t, int(crc16("foo{}{bar}"))%SlotCount, Slot("foo{}{bar}"))
+	assert.Equal(t, Slot("{bar"), Slot("foo{{bar}}zap"))
+}
+
+func TestSniffShards(t *testing.T) {
+	a, b := newFakeServer(t), newFakeServer(t)
+	defer a.close()
+	defer b.close()
+
+	a.on("CLUSTER SHARDS", shardsReply(
+		[3]string{"0", "8191", a.addr()},
+		[3]string{"8192", "16383", b.addr()},
+	))
+
+	c := NewCluster(nil)
+	assert.Equal(t, []string{a.addr(), b.addr()}, c.Sniff(&ctbase.Conn{URI: a.addr()}))
+	assert.Equal(t, b.addr(), c.Owner("foo"))
+	assert.Equal(t, a.addr(), c.Owner("bar"))
+}
+
+func TestSniffShardsTLS(t *testing.T) {
+	a, b := newFakeServer(t), newFakeServer(t)
+	defer a.close()
+	defer b.close()
+
+	shard := func(start, end, host, port string) string {
+		return "*4\r\n" + bulk("slots") + fmt.Sprintf("*2\r\n:%s\r\n:%s\r\n", start, end) +
+			bulk("nodes") + "*1\r\n*6\r\n" +
+			port +
+			bulk("ip") + bulk(host) +
+			bulk("role") + bulk("master")
+	}
+
+	// The shard whose node has neither port nor tls-port is skipped.
+	host, port, _ := net.SplitHostPort(b.addr())
+	a.on("CLUSTER SHARDS", "*2\r\n"+
+		shard("0", "8191", host, bulk("tls-port")+":"+port+"\r\n")+
+		shard("8192", "16383", host, bulk("hostname")+bulk("b")))
+
+	c := NewCluster(nil)
+	assert.Equal(t, []string{b.addr()}, c.Sniff(&ctbase.Conn{URI: a.addr()}))
+	assert.Equal(t, b.addr(), c.Owner("bar"))
+	assert.Equal(t, "", c.Owner("foo"))
+}
+
+func TestSniffSlotsFallback(t *testing.T) {
+	a, b := newFakeServer(t), newFakeServer(t)
+	defer a.close()
+	defer b.close()
+
+	// Redis 6 doesn't know CLUSTER SHARDS, and answers empty ip for itself.
+	a.on("CLUSTER SLOTS", slotsReply(
+		[3]string{"0", "8191", net.JoinHostPort("", a.port())},
+		[3]string{"8192", "16383", b.addr()},
+	))
+
+	c := NewCluster(nil)
+	assert.Equal(t, []string{a.addr(), b.addr()}, c.Sniff(&ctbase.Conn{URI: a.addr()}))
+	assert.Equal(t, b.addr(), c.Owner("foo"))
+}
+
+func TestParseRedirect(t *testing.T) {
+	kind, slot, addr, ok := parseRedirect("MOVED 3999 127.0.0.1:6381")
+	assert.True(t, ok)
+	assert.Equal(t, "MOVED", kind)
+	assert.Equal(t, 3999, slot)
+	assert.Equal(t, "127.0.0.1:6381", addr)
+
+	for _, msg := range []string{"ERR wrong", "MOVED x 127.0.0.1:6381", "ASK 16384 127.0.0.1:6381", "MOVED 1"} {
+		_, _, _, ok := parseRedirect(msg)
+		assert.False(t, ok, msg)
+	}
+}
+
+func TestDo(t *testing.T) {
+	a, b := newFakeServer(t), newFakeServer(t)
+	defer a.close()
+	defer b.close()
+
+	reply := slotsReply(
+		[3]string{"0", "8191", a.addr()},
+		[3]string{"8192", "16383", b.addr()},
+	)
+	a.on("CLUSTER SLOTS", reply)
+	b.on("CLUSTER SLOTS", reply)
+
+	c := NewCluster(nil)
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = c
+	cfg.Selector = c
+
+	ts := ctbase.NewTransport(cfg, a.addr())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, ts.Discover(ctx))
+
+	// owners is the truth on cluster side, which is changed by resharding.
+	owners := map[string]string{"foo": b.addr(), "bar": a.addr()}
+	migrating := map[string]string{}
+
+	misasked := false
+
+	get := func(key string) (interface{}, error) {
+		return c.Do(ts, key, func(conn *ctbase.Conn, asking bool) (interface{}, error) {
+			if to, ok := migrating[key]; ok {
+				if conn.URI != to && asking {
+					misasked = true
+				}
+				if conn.URI == to && asking {
+					return conn.URI, nil
+				}
+				if conn.URI != to {
+					return nil, errors.New("ASK " + strconv.Itoa(Slot(key)) + " " + to)
+				}
+			}
+			if owner := owners[key]; conn.URI != owner {
+				return nil, errors.New("MOVED " + strconv.Itoa(Slot(key)) + " " + owner)
+			}
+			return conn.URI, nil
+		})
+	}
+
+	item, err := get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, b.addr(), item)
+
+	// MOVED updates slot map.
+	owners["foo"] = a.addr()
+	item, err = get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, a.addr(), item)
+	assert.Equal(t, a.addr(), c.Owner("foo"))
+
+	// ASK retries once with ASKING, which doesn't update slot map.
+	migrating["bar"] = b.addr()
+	item, err = get("bar")
+	assert.NoError(t, err)
+	assert.Equal(t, b.addr(), item)
+	assert.Equal(t, a.addr(), c.Owner("bar"))
+
+	// ASKING isn't sent to another node when the node which ASK pointed is drained.
+	ts.Drain(b.addr())
+	_, err = get("bar")
+	assert.Error(t, err)
+	assert.False(t, misasked)
+}
@@ -0,0 +1,7 @@
+// Package redis implements ClusterBase interfaces for Redis.
+//
+// Cluster discovers topology of Redis Cluster via `CLUSTER SHARDS` or
+// `CLUSTER SLOTS`, and routes key-based requests to the owner of the key's
+// hash slot. Sentinel discovers the primary and replicas of a named service
+// via Redis Sentinel, and notices failover by `+switch-master` event.
+package redis
@@ -0,0 +1,281 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/pkg/errors"
+)
+
+// NewSentinel returns Sentinel which asks sentinels for nodes of the master
+// name, and builds clients via newClient.
+func NewSentinel(masterName string, newClient func(uri string) (interface{}, error), sentinels ...string) *Sentinel {
+	return &Sentinel{
+		MasterName: masterName,
+		Sentinels:  sentinels,
+		NewClient:  newClient,
+		Replicas:   true,
+		Timeout:    5 * time.Second,
+		Retry:      time.Second,
+	}
+}
+
+// Sentinel implements ClusterBase, LabelBase and DiscoveryWatcher interfaces
+// for Redis Sentinel. Connections are labeled as "role": "primary" or "replica".
+type Sentinel struct {
+	MasterName string
+	Sentinels  []string // Addresses of sentinels which are asked in order
+	NewClient  func(uri string) (interface{}, error)
+	Username   string        // For sentinels
+	Password   string        // For sentinels
+	Replicas   bool          // Default: Discovers replicas in addition to the primary
+	Timeout    time.Duration // Default: Gives up a command after 5 sec without context's deadline
+	Retry      time.Duration // Default: Subscribes to next sentinel after 1 sec when lost
+
+	mu    sync.RWMutex
+	roles map[string]string
+}
+
+// Sniff method returns the primary and replicas, which doesn't use conn
+// but sentinels.
+func (s *Sentinel) Sniff(conn *ctbase.Conn) []string {
+	return s.SniffContext(context.Background(), conn)
+}
+
+// SniffContext method returns the primary and replicas.
+func (s *Sentinel) SniffContext(ctx context.Context, conn *ctbase.Conn) []string {
+	uris, err := s.discover(ctx)
+	if err != nil {
+		return []string{}
+	}
+
+	return uris
+}
+
+// Conn method returns one of cluster system connection.
+func (s *Sentinel) Conn(uri string) (*ctbase.Conn, error) {
+	return s.ConnContext(context.Background(), uri)
+}
+
+// ConnContext method returns one of cluster system connection which is
+// labeled by its role.
+func (s *Sentinel) ConnContext(ctx context.Context, uri string) (*ctbase.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	conn := &ctbase.Conn{Labels: s.Labels(uri)}
+	if s.NewClient != nil {
+		client, err := s.NewClient(uri)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to build redis client")
+		}
+		conn.Client = client
+	}
+
+	return conn, nil
+}
+
+// Labels method returns role of the node which was discovered at last.
+func (s *Sentinel) Labels(uri string) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if role, ok := s.roles[uri]; ok {
+		return map[string]string{"role": role}
+	}
+	return nil
+}
+
+// Primary returns address of the primary which was discovered at last.
+func (s *Sentinel) Primary() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for uri, role := range s.roles {
+		if role == "primary" {
+			return uri
+		}
+	}
+	return ""
+}
+
+// Watch subscribes `+switch-master` event of sentinels, and then streams
+// new membership as soon as failover happened. It's used with Transport.Watch.
+func (s *Sentinel) Watch(ctx context.Context, events chan<- ctbase.NodeEvent) error {
+	for i := 0; ; i++ {
+		if len(s.Sentinels) <= 0 {
+			return errors.New("There's no sentinel")
+		}
+
+		// Tries to next sentinel when it lost the sentinel.
+		s.subscribe(ctx, s.Sentinels[i%len(s.Sentinels)], events)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		select {
+		case <-time.After(s.Retry):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Sentinel) subscribe(ctx context.Context, addr string, events chan<- ctbase.NodeEvent) error {
+	rc, err := s.dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if _, err := rc.do("SUBSCRIBE", "+switch-master"); err != nil {
+		return err
+	}
+	rc.conn.SetDeadline(time.Time{})
+
+	// Closes connection to stop reading when ctx is done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		reply, err := rc.read()
+		if err != nil {
+			return err
+		}
+
+		msg, ok := reply.([]interface{})
+		if !ok || len(msg) != 3 || msg[0] != "message" {
+			continue
+		}
+
+		// "<master name> <old ip> <old port> <new ip> <new port>"
+		payload, _ := msg[2].(string)
+		if fields := strings.Fields(payload); len(fields) != 5 || fields[0] != s.MasterName {
+			continue
+		}
+
+		uris, err := s.discover(ctx)
+		if err != nil {
+			continue
+		}
+
+		select {
+		case events <- ctbase.NodeEvent{Type: ctbase.NodesSet, URIs: uris}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// discover asks sentinels in order for the primary and replicas.
+func (s *Sentinel) discover(ctx context.Context) ([]string, error) {
+	err := errors.New("There's no sentinel")
+
+	for _, addr := range s.Sentinels {
+		var roles map[string]string
+		if roles, err = s.ask(ctx, addr); err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		s.roles = roles
+		s.mu.Unlock()
+
+		var primary string
+		replicas := []string{}
+		for uri, role := range roles {
+			if role == "primary" {
+				primary = uri
+			} else {
+				replicas = append(replicas, uri)
+			}
+		}
+		sort.Strings(replicas)
+
+		return append([]string{primary}, replicas...), nil
+	}
+
+	return nil, err
+}
+
+func (s *Sentinel) ask(ctx context.Context, addr string) (map[string]string, error) {
+	rc, err := s.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	reply, err := rc.do("SENTINEL", "get-master-addr-by-name", s.MasterName)
+	if err != nil {
+		return nil, err
+	}
+
+	master, ok := reply.([]interface{})
+	if !ok || len(master) != 2 {
+		return nil, fmt.Errorf("redis: sentinel doesn't know master %q", s.MasterName)
+	}
+	ip, _ := master[0].(string)
+	port, _ := master[1].(string)
+
+	roles := map[string]string{net.JoinHostPort(ip, port): "primary"}
+	if !s.Replicas {
+		return roles, nil
+	}
+
+	// SENTINEL replicas is supported by Redis 5.0 or later.
+	reply, err = rc.do("SENTINEL", "replicas", s.MasterName)
+	if _, ok := err.(respError); ok {
+		reply, err = rc.do("SENTINEL", "slaves", s.MasterName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	replicas, _ := reply.([]interface{})
+	for _, replica := range replicas {
+		fields := pairs(replica)
+
+		flags, _ := fields["flags"].(string)
+		if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") ||
+			strings.Contains(flags, "disconnected") {
+			continue
+		}
+
+		ip, _ := fields["ip"].(string)
+		port, _ := fields["port"].(string)
+		if ip == "" || port == "" {
+			continue
+		}
+		roles[net.JoinHostPort(ip, port)] = "replica"
+	}
+
+	return roles, nil
+}
+
+func (s *Sentinel) dial(ctx context.Context, addr string) (*respConn, error) {
+	rc, err := dialRESP(ctx, addr, s.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rc.auth(s.Username, s.Password); err != nil {
+		rc.Close()
+		return nil, err
+	}
+
+	return rc, nil
+}
@@ -0,0 +1,105 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	ctbase "github.com/ikeikeikeike/clustertransport-base"
+	"github.com/stretchr/testify/assert"
+)
+
+func masterReply(ip, port string) string {
+	return "*2\r\n" + bulk(ip) + bulk(port)
+}
+
+func replicasReply(replicas ...[3]string) string {
+	reply := "*" + strconv.Itoa(len(replicas)) + "\r\n"
+	for _, r := range replicas {
+		reply += "*6\r\n" + bulk("ip") + bulk(r[0]) + bulk("port") + bulk(r[1]) + bulk("flags") + bulk(r[2])
+	}
+	return reply
+}
+
+func TestSentinelSniff(t *testing.T) {
+	down := newFakeServer(t)
+	down.close()
+
+	s1 := newFakeServer(t)
+	defer s1.close()
+	s1.on("SENTINEL get-master-addr-by-name mymaster", masterReply("10.0.0.1", "6379"))
+	s1.on("SENTINEL replicas mymaster", replicasReply(
+		[3]string{"10.0.0.3", "6379", "slave"},
+		[3]string{"10.0.0.2", "6379", "slave"},
+		[3]string{"10.0.0.4", "6379", "s_down,slave"},
+	))
+
+	s := NewSentinel("mymaster", nil, down.addr(), s1.addr())
+	assert.Equal(t, []string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.3:6379"}, s.Sniff(nil))
+	assert.Equal(t, "10.0.0.1:6379", s.Primary())
+	assert.Equal(t, map[string]string{"role": "replica"}, s.Labels("10.0.0.2:6379"))
+
+	s.Replicas = false
+	assert.Equal(t, []string{"10.0.0.1:6379"}, s.Sniff(nil))
+}
+
+func TestSentinelSlavesFallback(t *testing.T) {
+	s1 := newFakeServer(t)
+	defer s1.close()
+	s1.on("SENTINEL get-master-addr-by-name mymaster", masterReply("10.0.0.1", "6379"))
+	s1.on("SENTINEL slaves mymaster", replicasReply([3]string{"10.0.0.2", "6379", "slave"}))
+
+	s := NewSentinel("mymaster", nil, s1.addr())
+	assert.Equal(t, []string{"10.0.0.1:6379", "10.0.0.2:6379"}, s.Sniff(nil))
+}
+
+func TestSentinelUnknownMaster(t *testing.T) {
+	s1 := newFakeServer(t)
+	defer s1.close()
+	s1.on("SENTINEL get-master-addr-by-name mymaster", "*-1\r\n")
+
+	s := NewSentinel("mymaster", nil, s1.addr())
+	assert.Empty(t, s.Sniff(nil))
+}
+
+func TestSentinelWatch(t *testing.T) {
+	s1 := newFakeServer(t)
+	defer s1.close()
+	s1.on("SENTINEL get-master-addr-by-name mymaster", masterReply("10.0.0.1", "6379"))
+	s1.on("SENTINEL replicas mymaster", replicasReply([3]string{"10.0.0.2", "6379", "slave"}))
+
+	s := NewSentinel("mymaster", nil, s1.addr())
+	cfg := ctbase.NewConfig()
+	cfg.Cluster = s
+	ts := ctbase.NewTransport(cfg, s.Sniff(nil)...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ts.Watch(ctx, s)
+
+	// Failover promotes the replica.
+	s1.on("SENTINEL get-master-addr-by-name mymaster", masterReply("10.0.0.2", "6379"))
+	s1.on("SENTINEL replicas mymaster", replicasReply([3]string{"10.0.0.1", "6379", "slave"}))
+
+	deadline := time.Now().Add(time.Second)
+	for s1.publish("+switch-master", "mymaster 10.0.0.1 6379 10.0.0.2 6379") <= 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	roles := map[string]string{}
+	for time.Now().Before(deadline) {
+		for i := 0; i < 2; i++ {
+			ts.Req(func(conn *ctbase.Conn) (interface{}, error) {
+				roles[conn.URI] = conn.Labels["role"]
+				return nil, nil
+			})
+		}
+		if roles["10.0.0.2:6379"] == "primary" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, map[string]string{"10.0.0.1:6379": "replica", "10.0.0.2:6379": "primary"}, roles)
+}
@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer is an in-process RESP server which answers by script.
+type fakeServer struct {
+	ln          net.Listener
+	mu          sync.Mutex
+	script      map[string]string // Command -> raw RESP reply
+	subscribers []*respConn
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	s := &fakeServer{ln: ln, script: map[string]string{"PING": "+PONG\r\n"}}
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) addr() string { return s.ln.Addr().String() }
+
+func (s *fakeServer) port() string {
+	_, port, _ := net.SplitHostPort(s.addr())
+	return port
+}
+
+func (s *fakeServer) close() { s.ln.Close() }
+
+func (s *fakeServer) on(cmd, reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script[cmd] = reply
+}
+
+// publish pushes a message to subscribers, and returns the number of them.
+func (s *fakeServer) publish(channel, msg string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, rc := range s.subscribers {
+		rc.w.WriteString("*3\r\n" + bulk("message") + bulk(channel) + bulk(msg))
+		rc.w.Flush()
+	}
+
+	return len(s.subscribers)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	rc := &respConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	for {
+		req, err := rc.read()
+		if err != nil {
+			return
+		}
+
+		var args []string
+		for _, arg := range req.([]interface{}) {
+			args = append(args, arg.(string))
+		}
+
+		s.mu.Lock()
+		reply, ok := s.script[strings.Join(args, " ")]
+		if args[0] == "SUBSCRIBE" && len(args) == 2 {
+			reply, ok = "*3\r\n"+bulk("subscribe")+bulk(args[1])+":1\r\n", true
+			s.subscribers = append(s.subscribers, rc)
+		}
+		if !ok {
+			reply = "-ERR unknown command\r\n"
+		}
+
+		rc.w.WriteString(reply)
+		rc.w.Flush()
+		s.mu.Unlock()
+	}
+}
+
+func bulk(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
@@ -0,0 +1,43 @@
+package redis
+
+import "strings"
+
+// SlotCount is the number of hash slots in Redis Cluster.
+const SlotCount = 16384
+
+var crc16tab [256]uint16
+
+func init() {
+	for i := range crc16tab {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16tab[i] = crc
+	}
+}
+
+// crc16 is CRC16-CCITT (XMODEM) which is used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16tab[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// Slot returns hash slot of the key. Only the hash tag is hashed when the
+// key has it, such as "{user1000}.following".
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key)) % SlotCount
+}
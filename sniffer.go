@@ -1,66 +1,379 @@
 package clustertransport
 
-func newSniffer(cfg *Config, conns *Conns) *Sniffer {
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type sniffKind int
+
+const (
+	sniffRefresh  sniffKind = iota // Sniffs cluster system, doesn't rebuild connections
+	sniffReload                    // Rebuilds connections by sniffed uris, sniffs when there's nothing
+	sniffDiscover                  // Sniffs cluster system, and then rebuilds connections
+	sniffPush                      // Rebuilds connections by changed membership
+)
+
+type sniffJob struct {
+	ctx  context.Context // It's nil for background work
+	kind sniffKind
+	conn *Conn
+	fun  func([]string) []string
+	done chan struct{}
+}
+
+type sniffResult struct {
+	kind    sniffKind
+	cc      []*Conn // It's nil when connections weren't rebuilt
+	labels  map[string]map[string]string
+	weights map[string]int
+	err     error
+	elapsed time.Duration
+	done    chan struct{}
+}
+
+// sniffConfig is a part of Config which is used on Sniffer's goroutine.
+type sniffConfig struct {
+	cluster      ClusterBase
+	log          *slog.Logger
+	tracer       Tracer
+	sniffTimeout time.Duration
+	dialTimeout  time.Duration
+}
+
+func newSniffConfig(cfg *Config) sniffConfig {
+	return sniffConfig{
+		cluster:      cfg.Cluster,
+		log:          cfg.log(),
+		tracer:       cfg.tracer(),
+		sniffTimeout: time.Duration(cfg.SniffTimeout) * time.Second,
+		dialTimeout:  time.Duration(cfg.DialTimeout) * time.Second,
+	}
+}
+
+// sniff asks to cluster system for node uris within sniffTimeout.
+func (sc sniffConfig) sniff(conn *Conn) []string {
+	if sc.sniffTimeout <= 0 {
+		return sc.cluster.Sniff(conn)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sc.sniffTimeout)
+	defer cancel()
+
+	if cluster, ok := sc.cluster.(ClusterContextBase); ok {
+		return cluster.SniffContext(ctx, conn)
+	}
+
+	// The buffered channel lets the goroutine finish after the deadline,
+	// and then the late result is discarded.
+	in := make(chan []string, 1)
+	go func() { in <- sc.cluster.Sniff(conn) }()
+
+	select {
+	case uris := <-in:
+		return uris
+	case <-ctx.Done():
+		sc.log.Warn("Sniff timed out", LogNode, conn.URI, LogError, ctx.Err())
+		return nil
+	}
+}
+
+// conn establishes one of cluster system connection within dialTimeout.
+func (sc sniffConfig) conn(uri string) (*Conn, error) {
+	if sc.dialTimeout <= 0 {
+		return sc.cluster.Conn(uri)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sc.dialTimeout)
+	defer cancel()
+
+	if cluster, ok := sc.cluster.(ClusterContextBase); ok {
+		return cluster.ConnContext(ctx, uri)
+	}
+
+	type result struct {
+		conn *Conn
+		err  error
+	}
+
+	in := make(chan result, 1)
+	go func() {
+		conn, err := sc.cluster.Conn(uri)
+		in <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-in:
+		return r.conn, r.err
+	case <-ctx.Done():
+		// A connection which is established after the deadline is closed.
+		go func() {
+			if r := <-in; r.err == nil {
+				closeConn(r.conn)
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// closeConn closes the client of conn when it's able to be closed.
+func closeConn(conn *Conn) {
+	if conn == nil {
+		return
+	}
+
+	switch c := conn.Client.(type) {
+	case io.Closer:
+		c.Close()
+	case interface{ Close() }:
+		c.Close()
+	}
+}
+
+func newSniffer(cfg *Config, conns *Conns, out chan *sniffResult) *Sniffer {
 	s := &Sniffer{
-		cfg:     cfg,
-		conns:   conns,
-		receive: make(chan *container),
+		sc:      newSniffConfig(cfg),
+		cc:      conns.all(),
+		jobs:    make(chan *sniffJob),
+		trigger: make(chan *sniffJob, 1),
+		out:     out,
 		exit:    make(chan struct{}),
-		lost:    make(chan struct{}),
 	}
 
 	go s.run()
 	return s
 }
 
-// Sniffer connects to cluster system for sniffering.
+// Sniffer connects to cluster system for sniffering, and builds connections
+// on its own goroutine so that requests never wait for discovery.
 type Sniffer struct {
-	cfg     *Config
-	conns   *Conns
-	receive chan *container
-	exit    chan struct{}
-	lost    chan struct{}
+	mu      sync.RWMutex
+	sc      sniffConfig
 	sniffed []string
+
+	cc      []*Conn // Connections which were built at last, which is guarded by mu
+	jobs    chan *sniffJob
+	trigger chan *sniffJob
+	out     chan *sniffResult
+	exit    chan struct{}
 }
 
-// Sniffed returns sniffed uris.
+// Sniffed returns uris which were sniffed at last.
 func (s *Sniffer) Sniffed() ([]string, error) {
-	c := &container{baggage: make(chan *baggage)}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	s.receive <- c
-	b := <-c.baggage
-
-	return b.item.([]string), nil
+	return append([]string{}, s.sniffed...), nil
 }
 
 // Exit closes goroutine loop.
 func (s *Sniffer) Exit() {
-	s.exit <- struct{}{}
+	close(s.exit)
 }
 
-func (s *Sniffer) sniff() {
-	conn, err := s.conns.conn()
-	if err != nil {
-		return
-	}
+func (s *Sniffer) configure(cfg *Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sc = newSniffConfig(cfg)
+}
+
+// reset replaces connections which were built at last with cc, such as when
+// Transport rejected the rebuilt ones.
+func (s *Sniffer) reset(cc []*Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cc = cc
+}
+
+// push rebuilds connections by membership which is changed by fun, and
+// waits until Transport swaps them in.
+func (s *Sniffer) push(fun func([]string) []string) {
+	done := make(chan struct{})
 
-	s.sniffed = s.cfg.Cluster.Sniff(conn)
+	select {
+	case s.jobs <- &sniffJob{kind: sniffPush, fun: fun, done: done}:
+		select {
+		case <-done:
+		case <-s.exit:
+		}
+	case <-s.exit:
+	}
 }
 
 func (s *Sniffer) run() {
+	var results []*sniffResult
+
 	for {
+		var (
+			out  chan *sniffResult
+			next *sniffResult
+		)
+		if len(results) > 0 {
+			out, next = s.out, results[0]
+		}
+
 		select {
-		case c := <-s.receive:
-			if len(s.sniffed) <= 0 {
-				s.sniff()
-			}
-			b := baggages.Get(s.sniffed, nil)
-			c.baggage <- b
-		case <-s.lost:
-			s.sniffed = make([]string, 0)
+		case job := <-s.jobs:
+			results = append(results, s.do(job))
+		case job := <-s.trigger:
+			results = append(results, s.do(job))
+		case out <- next:
+			results = results[1:]
 		case <-s.exit:
-			s.sniffed = make([]string, 0)
-			break
+			return
+		}
+	}
+}
+
+func (s *Sniffer) do(job *sniffJob) (r *sniffResult) {
+	s.mu.RLock()
+	sc, sniffed, built := s.sc, s.sniffed, s.cc
+	s.mu.RUnlock()
+
+	ctx := job.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, span := sc.tracer.Start(ctx, SpanDiscovery)
+	span.SetAttribute(AttrKind, job.kind.String())
+
+	r = &sniffResult{kind: job.kind, done: job.done}
+	defer func(began time.Time) {
+		r.elapsed = time.Since(began)
+		span.End(r.err)
+	}(time.Now())
+
+	var uris []string
+	switch job.kind {
+	case sniffRefresh:
+		if len(s.sniff(ctx, sc, job.conn)) <= 0 {
+			r.err = errors.New("There's no node which was discovered")
+		}
+		return r
+	case sniffReload:
+		if uris = sniffed; len(uris) <= 0 {
+			uris = s.sniff(ctx, sc, job.conn)
+		}
+	case sniffDiscover:
+		uris = s.sniff(ctx, sc, job.conn)
+	case sniffPush:
+		uris = job.fun(connURIs(built))
+	}
+
+	if len(uris) <= 0 {
+		r.err = errors.New("There's no node which was discovered")
+		return r
+	}
+
+	if lb, ok := sc.cluster.(LabelBase); ok {
+		r.labels = make(map[string]map[string]string, len(uris))
+		for _, uri := range uris {
+			r.labels[uri] = lb.Labels(uri)
+		}
+	}
+
+	if wb, ok := sc.cluster.(WeightBase); ok {
+		r.weights = make(map[string]int, len(uris))
+		for _, uri := range uris {
+			r.weights[uri] = wb.Weight(uri)
+		}
+	}
+
+	// Unchanged membership doesn't need to be rebuilt.
+	if sameURIs(uris, connURIs(built)) {
+		return r
+	}
+
+	cc := s.build(ctx, sc, built, uris)
+	if len(cc) <= 0 {
+		r.err = errors.New("Failed to connection establishment to all of nodes")
+		return r
+	}
+
+	s.mu.Lock()
+	s.cc = cc
+	s.mu.Unlock()
+
+	r.cc = cc
+	return r
+}
+
+func (s *Sniffer) sniff(ctx context.Context, sc sniffConfig, conn *Conn) []string {
+	if conn == nil {
+		return nil
+	}
+
+	_, span := sc.tracer.Start(ctx, SpanSniff)
+	span.SetAttribute(AttrNode, conn.URI)
+
+	uris := sc.sniff(conn)
+	span.SetAttribute(AttrNodes, len(uris))
+
+	if len(uris) <= 0 {
+		span.End(errors.New("There's no node which was sniffed"))
+		return uris
+	}
+	span.End(nil)
+
+	s.mu.Lock()
+	s.sniffed = uris
+	s.mu.Unlock()
+
+	return uris
+}
+
+func connURIs(cc []*Conn) []string {
+	uris := make([]string, 0, len(cc))
+	for _, c := range cc {
+		uris = append(uris, c.URI)
+	}
+
+	return uris
+}
+
+// build establishes connections, which reuses connections built already.
+func (s *Sniffer) build(ctx context.Context, sc sniffConfig, built []*Conn, uris []string) []*Conn {
+	_, span := sc.tracer.Start(ctx, SpanRebuild)
+
+	exists := make(map[string]*Conn, len(built))
+	for _, conn := range built {
+		exists[conn.URI] = conn
+	}
+
+	cc := buildConns(sc, exists, uris)
+	span.SetAttribute(AttrNodes, len(cc))
+
+	var err error
+	if len(cc) <= 0 {
+		err = errors.New("Failed to connection establishment to all of nodes")
+	}
+	span.End(err)
+
+	return cc
+}
+
+// sameURIs reports whether a and b contain the same uris regardless of order.
+func sameURIs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	seen := make(map[string]int, len(a))
+	for _, uri := range a {
+		seen[uri]++
+	}
+	for _, uri := range b {
+		if seen[uri]--; seen[uri] < 0 {
+			return false
 		}
 	}
+
+	return true
 }
@@ -1,27 +1,35 @@
 package clustertransport
 
 import (
-	"net"
-	"net/url"
-	"os"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
 	"time"
 )
 
+var errClosed = errors.New("Transport is closed")
+
 // NewTransport returns struct as a pointer.
 func NewTransport(cfg *Config, uris ...string) *Transport {
 	t := &Transport{
 		cfg:           cfg,
 		request:       make(chan *container, 100000),
 		configure:     make(chan struct{ fun func(*Config) *Config }),
+		exec:          make(chan func()),
+		discover:      make(chan *discoverRequest),
+		discovered:    make(chan *sniffResult),
 		exit:          make(chan struct{}),
 		lastRequestAt: time.Now(),
 	}
 
-	t.conns = t.buildConns(uris)
-	t.sniffer = newSniffer(cfg, t.conns)
+	t.logger = cfg.log()
+	t.conns = t.newConns(buildConns(newSniffConfig(cfg), nil, uris))
+	t.sniffer = newSniffer(cfg, t.conns, t.discovered)
+	cfg.metrics().Nodes(t.conns.uris(), nil)
 
 	if len(t.conns.alives()) > 0 {
-		t.reloadConns()
+		t.sniff(sniffReload)
 	}
 
 	go t.run()
@@ -31,30 +39,35 @@ func NewTransport(cfg *Config, uris ...string) *Transport {
 // Transport struct has public methods which handles all of connections.
 type Transport struct {
 	cfg           *Config
+	logger        *slog.Logger // Built from cfg by NewTransport and Configure
 	conns         *Conns
 	sniffer       *Sniffer
 	request       chan *container
 	configure     chan struct{ fun func(*Config) *Config }
+	exec          chan func()
+	discover      chan *discoverRequest
+	discovered    chan *sniffResult
 	exit          chan struct{}
+	closeOnce     sync.Once
 	counter       int64
 	lastRequestAt time.Time
+
+	discovering      bool
+	sniffs           int // Rotates nodes to sniff
+	notifies         []chan []string
+	discoverWaits    []chan error
+	lastDiscoverAt   time.Time
+	lastDiscoveredAt time.Time
+	lastDiscoverErr  error
 }
 
 // Arg returns a function which has a argument, that contains message passing processing.
 func (t *Transport) Arg(fun interface{}) func(interface{}) (interface{}, error) {
 	return func(arg interface{}) (interface{}, error) {
 		c := containers.Get()
-		defer containers.Put(c)
-
 		c.fun = fun
 		c.arg = arg
-		t.request <- c
-
-		b := <-c.baggage
-		defer baggages.Put(b)
-
-		item, err := b.item, b.err
-		return item, err
+		return t.send(c)
 	}
 }
 
@@ -62,48 +75,119 @@ func (t *Transport) Arg(fun interface{}) func(interface{}) (interface{}, error)
 func (t *Transport) Args(fun interface{}) func(...interface{}) (interface{}, error) {
 	return func(args ...interface{}) (interface{}, error) {
 		c := containers.Get()
-		defer containers.Put(c)
-
 		c.fun = fun
 		c.arg = args
-		t.request <- c
-
-		b := <-c.baggage
-		defer baggages.Put(b)
-
-		item, err := b.item, b.err
-		return item, err
+		return t.send(c)
 	}
 }
 
 // Req is gateway that's proccessing for request to cluster systems.
 func (t *Transport) Req(fun interface{}) (interface{}, error) {
+	return t.ReqContext(context.Background(), fun)
+}
+
+// ReqContext is gateway like Req, whose spans are children of the span in
+// ctx. fun is able to be `func(context.Context, *Conn) (interface{}, error)`
+// which receives ctx of the attempt. It gives up waiting for the request
+// when ctx is done, and the request which isn't run yet is skipped, but fun
+// which is running isn't interrupted unless it watches ctx by itself.
+func (t *Transport) ReqContext(ctx context.Context, fun interface{}) (interface{}, error) {
 	c := containers.Get()
-	defer containers.Put(c)
+	c.ctx = ctx
+	c.fun = fun
+	return t.send(c)
+}
+
+// ReqKey is gateway like Req, which requests to the node that's selected by
+// key when Selector implements KeySelectorBase interface.
+func (t *Transport) ReqKey(key string, fun interface{}) (interface{}, error) {
+	return t.ReqKeyContext(context.Background(), key, fun)
+}
 
+// ReqKeyContext is gateway like ReqKey with ctx as ReqContext.
+func (t *Transport) ReqKeyContext(ctx context.Context, key string, fun interface{}) (interface{}, error) {
+	c := containers.Get()
+	c.ctx = ctx
 	c.fun = fun
-	t.request <- c
+	c.key = key
+	return t.send(c)
+}
 
-	b := <-c.baggage
-	defer baggages.Put(b)
+// send sends the request to the goroutine which handles requests, and then
+// waits for its result until ctx of the request is done. The container is
+// returned to the pool only when it's never touched by the goroutine again.
+func (t *Transport) send(c *container) (interface{}, error) {
+	if c.ctx == nil {
+		c.ctx = context.Background()
+	}
+	done := c.ctx.Done()
 
-	item, err := b.item, b.err
-	return item, err
+	select {
+	case t.request <- c:
+	case <-done:
+		err := c.ctx.Err()
+		containers.Put(c)
+		return nil, err
+	case <-t.exit:
+		containers.Put(c)
+		return nil, errClosed
+	}
+
+	select {
+	case b := <-c.baggage:
+		item, err := b.item, b.err
+		baggages.Put(b)
+		containers.Put(c)
+		return item, err
+	case <-done:
+		// The result is sent into the buffered baggage later, and then the
+		// abandoned container is dropped.
+		return nil, c.ctx.Err()
+	case <-t.exit:
+		return nil, errClosed
+	}
 }
 
 // Configure configures value into Config field.
 func (t *Transport) Configure(fun func(cfg *Config) *Config) {
-	t.configure <- struct{ fun func(*Config) *Config }{fun: fun}
+	select {
+	case t.configure <- struct{ fun func(*Config) *Config }{fun: fun}:
+	case <-t.exit:
+	}
+}
+
+// Close stops goroutines of Transport and its Sniffer. Requests after Close
+// fail, and Snapshot returns nil.
+func (t *Transport) Close() {
+	t.closeOnce.Do(func() {
+		close(t.exit)
+	})
+}
+
+// do runs fun on the goroutine which handles requests, and waits for it. It
+// doesn't run fun after Close.
+func (t *Transport) do(fun func()) {
+	done := make(chan struct{})
+	select {
+	case t.exec <- func() {
+		fun()
+		close(done)
+	}:
+		<-done
+	case <-t.exit:
+	}
 }
 
 func (t *Transport) run() {
-	dTick := time.NewTicker(time.Duration(t.cfg.DiscoverTick) * time.Second)
+	dSecs, sSecs, tSecs := t.cfg.DiscoverTick, t.cfg.SniffTick, t.cfg.DebugTick
+
+	dTick := newTicker(dSecs)
 	defer dTick.Stop()
 
-	sTick := time.NewTicker(60 * time.Second)
+	sTick := newTicker(sSecs)
 	defer sTick.Stop()
 
-	tTick := time.NewTicker(5 * time.Second)
+	tTick := newTicker(tSecs)
 	defer tTick.Stop()
 
 	// debugTraceTick := time.NewTicker(60 * time.Second)
@@ -112,70 +196,147 @@ func (t *Transport) run() {
 	for {
 		select {
 		case c := <-t.request:
-			b := baggages.Get(t.req(c, 0))
-			c.baggage <- b
+			t.cfg.metrics().QueueDepth(len(t.request))
+
+			// The request which was given up while waiting isn't run.
+			if err := c.ctx.Err(); err != nil {
+				c.baggage <- baggages.Get(nil, err)
+				continue
+			}
+			c.baggage <- baggages.Get(t.traceReq(c))
 		case c := <-t.configure:
 			t.cfg = c.fun(t.cfg)
+			t.logger = t.cfg.log()
+			t.conns.log = t.logger
+			t.sniffer.configure(t.cfg)
+
+			resetTicker(dTick, &dSecs, t.cfg.DiscoverTick)
+			resetTicker(sTick, &sSecs, t.cfg.SniffTick)
+			resetTicker(tTick, &tSecs, t.cfg.DebugTick)
+		case fun := <-t.exec:
+			fun()
+		case d := <-t.discover:
+			t.discoverWaits = append(t.discoverWaits, d.wait)
+			t.sniffContext(d.ctx, sniffDiscover)
+		case r := <-t.discovered:
+			t.discoveredConns(r)
 		case <-dTick.C:
 			if t.cfg.Discover {
-				t.cfg.Logger("Discover clusters by `discoverTick`: "+
-					"next time after %d secs", t.cfg.DiscoverTick)
-				t.reloadConns()
+				t.log().Debug("Discover clusters by `discoverTick`",
+					"next_secs", t.cfg.DiscoverTick)
+				t.sniff(sniffReload)
 			}
 		case <-sTick.C:
-			t.sniffer.sniff()
+			t.sniff(sniffRefresh)
 		// For debug
 		case <-tTick.C:
 			if t.cfg.Debug {
-				t.cfg.Logger("counter:%d alives:%d deads:%d ",
-					t.counter, len(t.conns.alives()), len(t.conns.deads()))
+				t.log().Debug("Transport state", "counter", t.counter,
+					LogAlives, len(t.conns.alives()), LogDeads, len(t.conns.deads()))
 			}
 		// case <-debugTraceTick.C:
 		// pretty.Println(t.conns.all())
 		case <-t.exit:
-			break
+			t.sniffer.Exit()
+			return
 		}
 
 	}
 }
 
+// traceReq handles the request in a span.
+func (t *Transport) traceReq(c *container) (interface{}, error) {
+	ctx, span := t.cfg.tracer().Start(c.ctx, SpanRequest)
+	if c.key != "" {
+		span.SetAttribute(AttrKey, c.key)
+	}
+	c.ctx = ctx
+
+	item, err := t.req(c, 0)
+	span.SetAttribute(AttrErrorClass, string(Classify(err)))
+	span.End(err)
+
+	return item, err
+}
+
 func (t *Transport) req(c *container, tries int) (interface{}, error) {
-	conn, err := t.conn()
+	conn, err := t.conn(c)
 	if err != nil {
-		t.cfg.Logger(err.Error())
+		t.log().Error("There's no node to request", LogError, err)
 		return nil, err
 	}
 
 	tries++
 	var item interface{}
 
+	ctx, span := t.cfg.tracer().Start(c.ctx, SpanAttempt)
+	span.SetAttribute(AttrNode, conn.URI)
+	span.SetAttribute(AttrRetry, tries-1)
+
+	conn.begin()
+	began := time.Now()
+
 	switch fun := c.fun.(type) {
 	case func(*Conn) (interface{}, error):
 		item, err = fun(conn)
+	case func(context.Context, *Conn) (interface{}, error):
+		item, err = fun(ctx, conn)
 	case func(*Conn, interface{}) (interface{}, error):
 		item, err = fun(conn, c.arg)
 	case func(*Conn, ...interface{}) (interface{}, error):
 		item, err = fun(conn, c.arg.([]interface{})...)
 	}
 
+	latency := time.Since(began)
+	conn.done(latency, err)
+
+	class := Classify(err)
+	span.SetAttribute(AttrErrorClass, string(class))
+	span.End(err)
+
+	metrics := t.cfg.metrics()
+	metrics.Request(conn.URI, latency, class)
+
 	if err != nil {
-		switch err.(type) {
+		switch class {
+		case ErrorRedirect:
+			var e *Redirect
+			errors.As(err, &e)
+
+			if tries <= t.cfg.MaxRetries {
+				t.log().Debug("Request redirects", LogNode, conn.URI, "redirect", e.URI,
+					LogAttempt, tries, LogMaxRetries, t.cfg.MaxRetries, LogDuration, latency)
+				metrics.Retry(conn.URI, class)
+				c.redirect = e.URI
+				item, err = t.req(c, tries)
+			}
+
+			return item, err
+
 		default:
 			if tries <= t.cfg.MaxRetries {
-				t.cfg.Logger("Request retries %d/%d", tries, t.cfg.MaxRetries)
+				t.log().Debug("Request retries", LogNode, conn.URI, LogAttempt, tries,
+					LogMaxRetries, t.cfg.MaxRetries, LogErrorClass, class, LogError, err, LogDuration, latency)
+				metrics.Retry(conn.URI, class)
 				item, err = t.req(c, tries)
 			}
 
 			return item, err
 
-		case *url.Error, *net.OpError, *os.SyscallError, *Econnrefused:
+		case ErrorConnection:
 			// if len(t.conns.alives()) > 1 {
-			t.cfg.Logger("Close connection to cluster via %s", conn.URI)
+			t.log().Warn("Close connection to cluster", LogNode, conn.URI, LogAttempt, tries,
+				LogErrorClass, class, LogError, err, LogDuration, latency)
 			conn.terminate()
+			metrics.NodeDead(conn.URI)
 			// }
 
+			t.discoverOnFailure()
+
 			if t.cfg.RetryOnFailure && tries <= t.cfg.MaxRetries {
-				t.cfg.Logger("Do retryOnFailure %d/%d", tries, t.cfg.MaxRetries)
+				t.log().Debug("Do retryOnFailure", LogNode, conn.URI, LogAttempt, tries,
+					LogMaxRetries, t.cfg.MaxRetries)
+				metrics.Retry(conn.URI, class)
 				item, err = t.req(c, tries)
 			}
 
@@ -191,15 +352,24 @@ func (t *Transport) req(c *container, tries int) (interface{}, error) {
 	return item, err
 }
 
-func (t *Transport) buildConns(uris []string) *Conns {
+func (t *Transport) newConns(cc []*Conn) *Conns {
+	return &Conns{cfg: t.cfg, log: t.logger, cc: cc, selector: t.cfg.Selector}
+}
+
+// buildConns establishes connections to uris, which reuses exists connections.
+func buildConns(sc sniffConfig, exists map[string]*Conn, uris []string) []*Conn {
 	conns := make([]*Conn, 0)
 
 	for _, uri := range uris {
-		conn, err := t.cfg.Cluster.Conn(uri)
+		if conn, ok := exists[uri]; ok {
+			conns = append(conns, conn)
+			continue
+		}
+
+		conn, err := sc.conn(uri)
 
 		if err != nil {
-			t.cfg.Logger("Failed to connection establishment via %s: %s",
-				uri, err.Error())
+			sc.log.Warn("Failed to connection establishment", LogNode, uri, LogError, err)
 			continue
 		}
 
@@ -207,45 +377,73 @@ func (t *Transport) buildConns(uris []string) *Conns {
 		conns = append(conns, conn)
 	}
 
-	return &Conns{cfg: t.cfg, cc: conns, selector: t.cfg.Selector}
+	return conns
 }
 
-func (t *Transport) conn() (*Conn, error) {
+func (t *Transport) conn(c *container) (*Conn, error) {
+	if uri := c.redirect; uri != "" {
+		c.redirect = ""
+
+		// Dead or drained nodes are never selected by redirection either.
+		switch conn := t.conns.find(uri); {
+		case conn == nil:
+			t.log().Info("Discover clusters by redirection to unknown node", LogNode, uri)
+			t.sniff(sniffDiscover)
+		case conn.isDead() || conn.drained:
+			t.log().Debug("Skip redirection to dead or drained node", LogNode, uri)
+		default:
+			t.counter++
+			return conn, nil
+		}
+	}
+
 	if time.Now().Unix() > t.lastRequestAt.Unix()+t.cfg.ResurrectAfter {
-		t.cfg.Logger("Resurrect some of connections that hasn't request to "+
-			"cluster system until it passed %d sec.", t.cfg.ResurrectAfter)
+		t.log().Debug("Resurrect some of connections that hasn't request to cluster system",
+			"resurrect_after_secs", t.cfg.ResurrectAfter)
 		t.resurrectDeads()
 	}
 
 	t.counter++
 
 	if t.cfg.Discover && t.counter%t.cfg.DiscoverAfter == 0 {
-		t.cfg.Logger("Discover clusters by `discoverAfter`: "+
-			"next time after %d requests", t.cfg.DiscoverAfter)
-		t.reloadConns()
+		t.log().Debug("Discover clusters by `discoverAfter`",
+			"next_requests", t.cfg.DiscoverAfter)
+		t.sniff(sniffReload)
 	}
 
-	return t.conns.conn()
-}
-
-func (t *Transport) reloadConns() {
-	uris, _ := t.sniffer.Sniffed()
-	t.rebuildConns(uris)
+	return t.conns.conn(c.key)
 }
 
 func (t *Transport) resurrectDeads() {
 	for _, dead := range t.conns.deads() {
-		dead.resurrect()
+		if dead.resurrect(); !dead.isDead() {
+			t.cfg.metrics().NodeAlive(dead.URI)
+		}
 	}
 }
 
-func (t *Transport) rebuildConns(uris []string) {
-	// TODO
-	// t.cluster.CloseConns()
+// newTicker returns a ticker per secs, which never ticks when secs isn't positive.
+func newTicker(secs int) *time.Ticker {
+	if secs <= 0 {
+		tick := time.NewTicker(time.Hour)
+		tick.Stop()
+		return tick
+	}
 
-	if conns := t.buildConns(uris); len(conns.alives()) > 0 {
-		t.counter = 0
-		t.conns = conns
-		t.sniffer = newSniffer(t.cfg, t.conns)
+	return time.NewTicker(time.Duration(secs) * time.Second)
+}
+
+// resetTicker resets the ticker when secs was changed by Configure.
+func resetTicker(tick *time.Ticker, current *int, secs int) {
+	if *current == secs {
+		return
+	}
+	*current = secs
+
+	if secs <= 0 {
+		tick.Stop()
+		return
 	}
+
+	tick.Reset(time.Duration(secs) * time.Second)
 }
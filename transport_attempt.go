@@ -0,0 +1,116 @@
+package clustertransport
+
+import (
+	"context"
+	"time"
+)
+
+// Attempt is a request to the node which is acquired by Acquire. The request
+// is sent by the caller outside of the goroutine which handles requests, and
+// then the result is reported back by End.
+type Attempt struct {
+	URI    string
+	Client interface{}
+	Ctx    context.Context // Context of the attempt span
+
+	t     *Transport
+	conn  *Conn
+	span  Span
+	began time.Time
+	ended bool
+}
+
+// Pick returns uri of the node which is selected by key like ReqKey, which
+// neither counts requests nor resurrects dead nodes, so that health, stats,
+// metrics and spans are untouched. The dead node which has the fewest
+// failures is returned when all of nodes are dead.
+func (t *Transport) Pick(key string) (string, error) {
+	var conn *Conn
+	err := errClosed
+	t.do(func() {
+		conn, err = t.conns.pick(key)
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return conn.URI, nil
+}
+
+// Acquire selects the node by key like ReqKeyContext, and begins an attempt
+// to the node. The request isn't serialized with others as Req does, and the
+// attempt must be ended by End with the result of the request.
+func (t *Transport) Acquire(ctx context.Context, key string) (*Attempt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a := &Attempt{t: t}
+
+	err := errClosed
+	t.do(func() {
+		a.conn, err = t.conn(&container{key: key})
+		if err != nil {
+			t.log().Error("There's no node to request", LogError, err)
+			return
+		}
+
+		a.Ctx, a.span = t.cfg.tracer().Start(ctx, SpanAttempt)
+		a.span.SetAttribute(AttrNode, a.conn.URI)
+
+		a.conn.begin()
+		a.began = time.Now()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	a.URI, a.Client = a.conn.URI, a.conn.Client
+	return a, nil
+}
+
+// End ends the attempt with the result of the request. Connection errors
+// mark the node as dead, and success marks it as healthy, as Req does. It
+// does nothing when the attempt was ended already.
+func (a *Attempt) End(err error) {
+	latency := time.Since(a.began)
+	a.t.do(func() {
+		if a.ended {
+			return
+		}
+		a.ended = true
+
+		a.t.end(a, latency, err)
+	})
+}
+
+func (t *Transport) end(a *Attempt, latency time.Duration, err error) {
+	conn := a.conn
+	conn.done(latency, err)
+
+	class := Classify(err)
+	a.span.SetAttribute(AttrErrorClass, string(class))
+	a.span.End(err)
+
+	t.cfg.metrics().Request(conn.URI, latency, class)
+
+	switch {
+	case class == ErrorConnection:
+		// Concurrent attempts to the node mustn't multiply its failures.
+		if !conn.isDead() {
+			t.log().Warn("Close connection to cluster", LogNode, conn.URI,
+				LogErrorClass, class, LogError, err, LogDuration, latency)
+			conn.terminate()
+			t.cfg.metrics().NodeDead(conn.URI)
+		}
+
+		t.discoverOnFailure()
+	case err == nil:
+		if conn.Failures > 0 {
+			conn.healthy()
+		}
+
+		t.lastRequestAt = time.Now()
+	}
+}
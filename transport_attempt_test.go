@@ -0,0 +1,67 @@
+package clustertransport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPick(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1", "127.0.0.1:2")
+	ts.MarkDead("127.0.0.1:1")
+
+	for i := 0; i < 3; i++ {
+		uri, err := ts.Pick("")
+		assert.NoError(t, err)
+		assert.Equal(t, "127.0.0.1:2", uri)
+	}
+	assert.Equal(t, int64(0), ts.Snapshot().Counter, "picking isn't a request")
+
+	// The dead node is picked without resurrecting when all of nodes are dead.
+	ts.MarkDead("127.0.0.1:2")
+	ts.MarkDead("127.0.0.1:2")
+	uri, err := ts.Pick("")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:1", uri)
+	assert.Equal(t, 2, ts.Snapshot().Deads)
+}
+
+func TestAcquire(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1")
+	ts.Configure(func(cfg *Config) *Config {
+		cfg.DiscoverOnFailure = false
+		cfg.DiscoverRatio = 0
+		return cfg
+	})
+
+	a1, err := ts.Acquire(context.Background(), "")
+	assert.NoError(t, err)
+	a2, err := ts.Acquire(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), ts.Snapshot().Nodes[0].InFlight)
+
+	a1.End(&Econnrefused{s: "refused"})
+	a2.End(&Econnrefused{s: "refused"})
+	a2.End(nil)
+
+	node := ts.Snapshot().Nodes[0]
+	assert.True(t, node.Dead)
+	assert.Equal(t, int64(1), node.Failures, "concurrent failures are counted once")
+	assert.Equal(t, int64(0), node.InFlight)
+	assert.Equal(t, int64(2), node.Requests)
+
+	// The dead node is resurrected as Req does, and success makes it healthy.
+	a, err := ts.Acquire(context.Background(), "")
+	assert.NoError(t, err)
+	a.End(nil)
+
+	node = ts.Snapshot().Nodes[0]
+	assert.False(t, node.Dead)
+	assert.Equal(t, int64(0), node.Failures)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ts.Acquire(ctx, "")
+	assert.Equal(t, context.Canceled, err)
+}
@@ -2,12 +2,14 @@ package clustertransport
 
 import (
 	"errors"
+	"log/slog"
 	"sort"
 )
 
 // Conns handles cluster system connection as collection.
 type Conns struct {
 	cfg      *Config
+	log      *slog.Logger
 	cc       []*Conn
 	selector SelectorBase
 }
@@ -24,7 +26,7 @@ func (cs *Conns) uris() []string {
 func (cs *Conns) alives() []*Conn {
 	conns := make([]*Conn, 0)
 	for _, c := range cs.all() {
-		if c.Dead {
+		if c.Dead || c.drained {
 			continue
 		}
 
@@ -51,21 +53,92 @@ func (cs *Conns) all() []*Conn {
 	return cs.cc
 }
 
-func (cs *Conns) conn() (*Conn, error) {
-	if len(cs.alives()) <= 0 {
-		deads := cs.deads()
+func (cs *Conns) find(uri string) *Conn {
+	for _, c := range cs.all() {
+		if c.URI == uri {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// undrained returns connections which aren't drained, which contains dead ones.
+func (cs *Conns) undrained() []*Conn {
+	conns := make([]*Conn, 0)
+	for _, c := range cs.all() {
+		if c.drained {
+			continue
+		}
+
+		conns = append(conns, c)
+	}
+
+	return conns
+}
+
+// resurrectables returns dead connections which aren't drained.
+func (cs *Conns) resurrectables() []*Conn {
+	conns := make([]*Conn, 0)
+	for _, c := range cs.deads() {
+		if c.drained {
+			continue
+		}
+
+		conns = append(conns, c)
+	}
+
+	return conns
+}
+
+func (cs *Conns) conn(key string) (*Conn, error) {
+	alives := cs.alives()
+
+	if len(alives) <= 0 {
+		deads := cs.resurrectables()
 		if len(deads) <= 0 {
 			return nil, errors.New("There's no connection already")
 		}
 
 		sort.Sort(sort.Reverse(connsSort(deads)))
 		deads[0].alive()
+		cs.cfg.metrics().NodeAlive(deads[0].URI)
+
+		cs.log.Info("Resurrect a connection", LogNode, deads[0].URI,
+			LogFailures, deads[0].Failures, "dead_since", deads[0].deadSince)
+
+		alives = []*Conn{deads[0]}
+	}
+
+	return cs.selectConn(alives, key), nil
+}
 
-		cs.cfg.Logger("Resurrect a connection via %s (failures:%d deadSince:%v)",
-			deads[0].URI, deads[0].Failures, deads[0].deadSince)
+// pick selects a connection like conn, which never resurrects dead ones. The
+// dead one which has the fewest failures is picked when all of them are dead.
+func (cs *Conns) pick(key string) (*Conn, error) {
+	alives := cs.alives()
+
+	if len(alives) <= 0 {
+		deads := cs.resurrectables()
+		if len(deads) <= 0 {
+			return nil, errors.New("There's no connection already")
+		}
+
+		sort.Sort(sort.Reverse(connsSort(deads)))
+		return deads[0], nil
+	}
+
+	return cs.selectConn(alives, key), nil
+}
+
+func (cs *Conns) selectConn(alives []*Conn, key string) *Conn {
+	if ks, ok := cs.selector.(KeySelectorBase); ok && key != "" {
+		if conn := ks.SelectKey(alives, key); conn != nil {
+			return conn
+		}
 	}
 
-	return cs.selector.Select(cs.alives()), nil
+	return cs.selector.Select(alives)
 }
 
 type connsSort []*Conn
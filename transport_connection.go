@@ -2,6 +2,7 @@ package clustertransport
 
 import (
 	"math"
+	"strings"
 	"time"
 )
 
@@ -9,10 +10,58 @@ import (
 type Conn struct {
 	Client    interface{}
 	URI       string
+	Labels    map[string]string
+	Weight    int
 	Failures  int64 // Counter
 	Dead      bool
 	rebirth   int64
 	deadSince time.Time
+	drained   bool
+	stats     connStats
+}
+
+// Addr strips scheme and path of uri, which returns host:port to dial.
+func Addr(uri string) string {
+	if i := strings.Index(uri, "://"); i >= 0 {
+		uri = uri[i+3:]
+	}
+	if i := strings.IndexAny(uri, "/?"); i >= 0 {
+		uri = uri[:i]
+	}
+	return uri
+}
+
+// connStats is statistics of requests to the node.
+type connStats struct {
+	inFlight int64
+	requests int64
+	errors   int64
+	latency  time.Duration // Total
+	min      time.Duration
+	max      time.Duration
+	last     time.Duration
+}
+
+func (c *Conn) begin() {
+	c.stats.inFlight++
+}
+
+func (c *Conn) done(latency time.Duration, err error) {
+	s := &c.stats
+	s.inFlight--
+	s.requests++
+	if err != nil {
+		s.errors++
+	}
+
+	s.latency += latency
+	s.last = latency
+	if s.min == 0 || latency < s.min {
+		s.min = latency
+	}
+	if latency > s.max {
+		s.max = latency
+	}
 }
 
 func (c *Conn) terminate() {
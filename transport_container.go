@@ -1,21 +1,28 @@
 package clustertransport
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 type container struct {
-	baggage chan *baggage
-	arg     interface{}
-	fun     interface{}
+	ctx      context.Context
+	baggage  chan *baggage
+	arg      interface{}
+	fun      interface{}
+	key      string
+	redirect string
 }
 
-var defcontainer = &container{
-	baggage: make(chan *baggage),
-}
+var defcontainer = &container{}
 
+// reset clears the container except baggage, which is its own channel.
 func (c *container) reset() {
-	c.baggage = defcontainer.baggage
+	c.ctx = defcontainer.ctx
 	c.arg = defcontainer.arg
 	c.fun = defcontainer.fun
+	c.key = defcontainer.key
+	c.redirect = defcontainer.redirect
 }
 
 type containerPool struct {
@@ -35,7 +42,9 @@ func (cp *containerPool) Put(c *container) {
 
 var containers = &containerPool{
 	Pool: sync.Pool{New: func() interface{} {
-		return &container{baggage: make(chan *baggage)}
+		// It's buffered, so that a result is able to be sent without waiting
+		// for the request which was given up.
+		return &container{baggage: make(chan *baggage, 1)}
 	}},
 }
 
@@ -0,0 +1,354 @@
+package clustertransport
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SetNodes replaces all of nodes with uris, and returns when new connections
+// were swapped in. It, AddNode and RemoveNode wait for the goroutine which
+// handles requests, so that they mustn't be called from functions of Req.
+func (t *Transport) SetNodes(uris ...string) {
+	uris = append([]string{}, uris...)
+	t.sniffer.push(func([]string) []string {
+		return uris
+	})
+}
+
+// AddNode adds a node into cluster connections.
+func (t *Transport) AddNode(uri string) {
+	t.sniffer.push(func(uris []string) []string {
+		for _, u := range uris {
+			if u == uri {
+				return uris
+			}
+		}
+		return append(uris, uri)
+	})
+}
+
+// RemoveNode removes a node from cluster connections. The last
+// one of alive nodes is never removed.
+func (t *Transport) RemoveNode(uri string) {
+	t.sniffer.push(func(uris []string) []string {
+		kept := make([]string, 0, len(uris))
+		for _, u := range uris {
+			if u != uri {
+				kept = append(kept, u)
+			}
+		}
+		return kept
+	})
+}
+
+// Nodes returns uris of all of nodes, which contains dead nodes.
+func (t *Transport) Nodes() []string {
+	var uris []string
+	t.do(func() {
+		uris = t.conns.uris()
+	})
+
+	return uris
+}
+
+// Notify returns a channel which receives nodes whenever connections were
+// swapped in, and receives current nodes right away. The channel keeps only
+// the latest nodes, and then it's closed when ctx is done.
+func (t *Transport) Notify(ctx context.Context) <-chan []string {
+	ch := make(chan []string, 1)
+	t.do(func() {
+		t.notifies = append(t.notifies, ch)
+		ch <- t.conns.uris()
+	})
+
+	go func() {
+		<-ctx.Done()
+		t.do(func() {
+			for i, c := range t.notifies {
+				if c == ch {
+					t.notifies = append(t.notifies[:i], t.notifies[i+1:]...)
+					break
+				}
+			}
+			close(ch)
+		})
+	}()
+
+	return ch
+}
+
+// notifyNodes sends nodes to channels of Notify, which replaces nodes that
+// haven't been received yet.
+func (t *Transport) notifyNodes() {
+	for _, ch := range t.notifies {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- t.conns.uris()
+	}
+}
+
+// MarkDead marks the node as dead, such as when a request which is sent
+// without Req failed. It reports whether the node was found.
+func (t *Transport) MarkDead(uri string) bool {
+	found := false
+	t.do(func() {
+		conn := t.conns.find(uri)
+		if found = conn != nil; found && !conn.isDead() {
+			t.log().Warn("Close connection to cluster", LogNode, uri)
+			conn.terminate()
+			t.cfg.metrics().NodeDead(uri)
+			t.discoverOnFailure()
+		}
+	})
+
+	return found
+}
+
+// MarkAlive marks the node as alive and healthy. It reports whether the
+// node was found.
+func (t *Transport) MarkAlive(uri string) bool {
+	found := false
+	t.do(func() {
+		conn := t.conns.find(uri)
+		if found = conn != nil; found {
+			if conn.isDead() {
+				t.cfg.metrics().NodeAlive(uri)
+			}
+			conn.healthy()
+		}
+	})
+
+	return found
+}
+
+// Drain stops sending requests to the node until Undrain, which is kept
+// over discovery. It reports whether the node was found.
+func (t *Transport) Drain(uri string) bool {
+	found := false
+	t.do(func() {
+		conn := t.conns.find(uri)
+		if found = conn != nil; found {
+			t.log().Info("Drain connection to cluster", LogNode, uri)
+			conn.drained = true
+		}
+	})
+
+	return found
+}
+
+// Undrain lets the node which was drained receive requests again. It
+// reports whether the node was found.
+func (t *Transport) Undrain(uri string) bool {
+	found := false
+	t.do(func() {
+		conn := t.conns.find(uri)
+		if found = conn != nil; found {
+			t.log().Info("Undrain connection to cluster", LogNode, uri)
+			conn.drained = false
+		}
+	})
+
+	return found
+}
+
+// Watch applies membership changes which are streamed by DiscoveryWatcher
+// until ctx is done or the watcher returns. Events which are sent after ctx
+// is done are dropped until the watcher returns.
+func (t *Transport) Watch(ctx context.Context, w DiscoveryWatcher) error {
+	events := make(chan NodeEvent)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- w.Watch(ctx, events)
+	}()
+
+	for {
+		select {
+		case ev := <-events:
+			switch ev.Type {
+			case NodesSet:
+				t.SetNodes(ev.URIs...)
+			case NodeAdded:
+				for _, uri := range ev.URIs {
+					t.AddNode(uri)
+				}
+			case NodeRemoved:
+				for _, uri := range ev.URIs {
+					t.RemoveNode(uri)
+				}
+			}
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			// Events are drained until the watcher returns, so that the
+			// watcher which sends without watching ctx isn't blocked.
+			go func() {
+				for {
+					select {
+					case <-events:
+					case <-done:
+						return
+					}
+				}
+			}()
+			return ctx.Err()
+		}
+	}
+}
+
+// Discover sniffs cluster system and rebuilds connections right now. It
+// returns when connections were rebuilt or ctx is done.
+func (t *Transport) Discover(ctx context.Context) error {
+	wait := make(chan error, 1)
+
+	select {
+	case t.discover <- &discoverRequest{ctx: ctx, wait: wait}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.exit:
+		return errClosed
+	}
+
+	select {
+	case err := <-wait:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.exit:
+		return errClosed
+	}
+}
+
+// discoverOnFailure sniffs cluster system in background when one of
+// connection was marked dead. DiscoverRatio is a fallback which is consulted
+// only when DiscoverOnFailure is false, which sniffs when alive connections
+// dropped below the ratio.
+func (t *Transport) discoverOnFailure() {
+	if !t.cfg.Discover {
+		return
+	}
+
+	if !t.cfg.DiscoverOnFailure {
+		// Drained connections are neither alive nor dead.
+		all := len(t.conns.undrained())
+		if all <= 0 || float64(len(t.conns.alives()))/float64(all) >= t.cfg.DiscoverRatio {
+			return
+		}
+	}
+
+	interval := time.Duration(t.cfg.DiscoverInterval) * time.Second
+	if time.Since(t.lastDiscoverAt) < interval {
+		return
+	}
+
+	t.log().Info("Discover clusters by failures",
+		LogAlives, len(t.conns.alives()), LogDeads, len(t.conns.deads()))
+	t.sniff(sniffDiscover)
+}
+
+// discoverRequest is a request of Discover.
+type discoverRequest struct {
+	ctx  context.Context
+	wait chan error
+}
+
+// sniff lets Sniffer work in background, and then the result is sent back to
+// the `discovered` channel. There's only one of work at the same time.
+func (t *Transport) sniff(kind sniffKind) {
+	t.sniffContext(context.Background(), kind)
+}
+
+// sniffContext is sniff whose spans are children of the span in ctx.
+func (t *Transport) sniffContext(ctx context.Context, kind sniffKind) {
+	if t.discovering {
+		return
+	}
+
+	conn := t.sniffTarget()
+
+	t.discovering = true
+	t.lastDiscoverAt = time.Now()
+	t.sniffer.trigger <- &sniffJob{ctx: ctx, kind: kind, conn: conn}
+}
+
+// sniffTarget returns one of connections to sniff cluster system, which
+// rotates alive ones without Selector, and never resurrects dead ones.
+func (t *Transport) sniffTarget() *Conn {
+	conns := t.conns.alives()
+	if len(conns) <= 0 {
+		conns = t.conns.all()
+	}
+	if len(conns) <= 0 {
+		return nil
+	}
+
+	t.sniffs++
+	return conns[t.sniffs%len(conns)]
+}
+
+// discoveredConns swaps new connections in.
+func (t *Transport) discoveredConns(r *sniffResult) {
+	err := r.err
+
+	if r.cc != nil {
+		// Reused connections may be drained, which are still available.
+		if conns := t.newConns(r.cc); len(conns.all()) > len(conns.deads()) {
+			t.log().Info("Swap discovered connections in", LogKind, r.kind.String(),
+				LogNodes, len(conns.all()), LogDuration, r.elapsed)
+			added, removed := diffURIs(t.conns.uris(), conns.uris())
+			t.counter = 0
+			t.conns = conns
+			t.cfg.metrics().Nodes(added, removed)
+			t.notifyNodes()
+		} else {
+			err = errors.New("There's no alive connection which was rebuilt")
+			t.sniffer.reset(t.conns.all())
+		}
+	}
+
+	// Reused connections are labeled and weighted again, such as a replica
+	// which was promoted.
+	for _, conn := range t.conns.all() {
+		if labels, ok := r.labels[conn.URI]; ok {
+			conn.Labels = labels
+		}
+		if weight, ok := r.weights[conn.URI]; ok {
+			conn.Weight = weight
+		}
+	}
+
+	if r.kind == sniffPush {
+		t.cfg.metrics().Discovery(r.kind.String(), r.elapsed, err)
+		close(r.done)
+		return
+	}
+
+	t.discovering = false
+	t.lastDiscoveredAt = time.Now()
+	t.lastDiscoverErr = err
+	t.cfg.metrics().Discovery(r.kind.String(), r.elapsed, err)
+
+	if err != nil {
+		t.log().Warn("Failed to discover clusters", LogKind, r.kind.String(),
+			LogError, err, LogDuration, r.elapsed)
+	}
+
+	// Refreshing and reloading don't sniff right now as Discover does, such
+	// as reloading which rebuilds connections by nodes that were sniffed.
+	if r.kind != sniffDiscover && len(t.discoverWaits) > 0 {
+		t.sniff(sniffDiscover)
+		return
+	}
+
+	t.notifyDiscovered(err)
+}
+
+func (t *Transport) notifyDiscovered(err error) {
+	for _, wait := range t.discoverWaits {
+		wait <- err
+	}
+	t.discoverWaits = nil
+}
@@ -0,0 +1,162 @@
+package clustertransport
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// NewRoundTripper returns RoundTripper which sends requests to nodes of t.
+func NewRoundTripper(t *Transport) *RoundTripper {
+	return &RoundTripper{
+		Transport: t,
+		Base:      http.DefaultTransport,
+		Retries:   3,
+	}
+}
+
+// RoundTripper implements http.RoundTripper interface, which rewrites
+// scheme and host of a request into uri of the node that's selected by
+// Transport. Transport errors and 5xx responses mark the node as dead, and
+// idempotent requests are retried on another node.
+type RoundTripper struct {
+	Transport *Transport
+	Base      http.RoundTripper // Default: http.DefaultTransport
+	Retries   int               // Default: Retries an idempotent request 3 times
+
+	// IsFailure reports whether the response means that the node is unhealthy.
+	// Default: 5xx responses except 501 Not Implemented.
+	IsFailure func(resp *http.Response) bool
+}
+
+// roundTrip is a result of sending the request to a node.
+type roundTrip struct {
+	resp *http.Response
+	err  error
+}
+
+// RoundTrip sends the request to one of nodes. The request is sent outside
+// of the goroutine which handles requests of Transport, so that requests
+// aren't serialized.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	idempotent := isIdempotent(req)
+
+	var last *roundTrip // The last failure which is returned when retries are exhausted
+
+	for sent := 0; sent <= rt.Retries && (sent <= 0 || idempotent); {
+		a, err := rt.Transport.Acquire(req.Context(), "")
+		if err != nil && (last == nil || req.Context().Err() != nil) {
+			last.close()
+			return nil, fmt.Errorf("There's no node which is able to request %s %s: %w", req.Method, req.URL, err)
+		}
+		if err != nil {
+			break
+		}
+
+		out, err := rt.rewrite(req, a.URI, sent)
+		if err != nil {
+			a.End(err)
+			last.close()
+			return nil, err
+		}
+		sent++
+
+		resp, err := rt.base().RoundTrip(out)
+		switch {
+		case err != nil && req.Context().Err() != nil:
+			a.End(err)
+			last.close()
+			return nil, err
+		case err != nil:
+			a.End(&url.Error{Op: req.Method, URL: out.URL.String(), Err: err})
+			last.close()
+			last = &roundTrip{err: err}
+		case rt.isFailure(resp):
+			a.End(&Econnrefused{s: fmt.Sprintf("%s responded %s", a.URI, resp.Status)})
+			last.close()
+			last = &roundTrip{resp: resp}
+		default:
+			a.End(nil)
+			last.close()
+			return resp, nil
+		}
+	}
+
+	return last.resp, last.err
+}
+
+// rewrite clones the request for the node of uri.
+func (rt *RoundTripper) rewrite(req *http.Request, uri string, sent int) (*http.Request, error) {
+	if !strings.Contains(uri, "://") {
+		uri = req.URL.Scheme + "://" + uri
+	}
+
+	node, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	out := req.Clone(req.Context())
+	out.URL.Scheme = node.Scheme
+	out.URL.Host = node.Host
+	out.Host = ""
+
+	if node.Path != "" && node.Path != "/" {
+		out.URL.Path = path.Join(node.Path, req.URL.Path)
+		out.URL.RawPath = ""
+	}
+	if node.User != nil {
+		out.URL.User = node.User
+	}
+
+	if sent > 0 && req.Body != nil && req.Body != http.NoBody {
+		if out.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func (rt *RoundTripper) base() http.RoundTripper {
+	if rt.Base == nil {
+		return http.DefaultTransport
+	}
+	return rt.Base
+}
+
+func (rt *RoundTripper) isFailure(resp *http.Response) bool {
+	if rt.IsFailure != nil {
+		return rt.IsFailure(resp)
+	}
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented
+}
+
+func (r *roundTrip) close() {
+	if r != nil && r.resp != nil {
+		io.Copy(io.Discard, r.resp.Body)
+		r.resp.Body.Close()
+	}
+}
+
+// isIdempotent reports whether the request is able to be sent again, as
+// net/http does.
+func isIdempotent(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	_, ok := req.Header["Idempotency-Key"]
+	if !ok {
+		_, ok = req.Header["X-Idempotency-Key"]
+	}
+	return ok
+}
@@ -0,0 +1,115 @@
+package clustertransport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Keys of structured log attributes, which are consistent over messages.
+const (
+	LogNode       = "node"        // Uri of the node
+	LogAttempt    = "attempt"     // Attempt number of the request, which starts from 1
+	LogMaxRetries = "max_retries" // Config.MaxRetries
+	LogErrorClass = "error_class" // ErrorClass
+	LogError      = "error"
+	LogDuration   = "duration"
+	LogKind       = "kind"     // Kind of the discovery
+	LogFailures   = "failures" // Failures of the node
+	LogNodes      = "nodes"    // Number of nodes
+	LogAlives     = "alives"   // Number of alive nodes
+	LogDeads      = "deads"    // Number of dead nodes
+)
+
+// log returns the logger which was built from Config.
+func (t *Transport) log() *slog.Logger {
+	return t.logger
+}
+
+// log returns Config.Slog, or a logger which writes into Config.Logger at
+// all of levels. It builds a new logger every time, so that Transport
+// keeps the one which it built.
+func (cfg *Config) log() *slog.Logger {
+	if cfg.Slog != nil {
+		return cfg.Slog
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = PrintNothing
+	}
+	return slog.New(NewLoggerHandler(logger, slog.LevelDebug))
+}
+
+// NewLoggerHandler returns slog.Handler which writes records of level or
+// higher into printf-style fun such as log.Printf, as `message key=value ...`.
+func NewLoggerHandler(fun func(format string, params ...interface{}), level slog.Leveler) slog.Handler {
+	return &loggerHandler{fun: fun, level: level}
+}
+
+type loggerHandler struct {
+	fun    func(format string, params ...interface{})
+	level  slog.Leveler
+	attrs  string // Preformatted attributes of WithAttrs
+	prefix string // Group prefix of keys
+}
+
+func (h *loggerHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *loggerHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, h.prefix, a)
+		return true
+	})
+
+	h.fun("%s", b.String())
+	return nil
+}
+
+func (h *loggerHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, a := range attrs {
+		writeAttr(&b, h.prefix, a)
+	}
+
+	h2 := *h
+	h2.attrs = b.String()
+	return &h2
+}
+
+func (h *loggerHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+func writeAttr(b *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, prefix, ga)
+		}
+		return
+	}
+
+	fmt.Fprintf(b, " %s%s=%v", prefix, a.Key, a.Value)
+}
@@ -0,0 +1,101 @@
+package clustertransport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns JSON records of the message.
+func (b *syncBuffer) records(msg string) []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var r map[string]interface{}
+		if json.Unmarshal([]byte(line), &r) == nil && r["msg"] == msg {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func TestSlog(t *testing.T) {
+	buf := &syncBuffer{}
+
+	cfg := NewConfig()
+	cfg.Cluster = &stubCluster{}
+	cfg.Slog = slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	cfg.Discover = false
+	cfg.MaxRetries = 1
+	ts := NewTransport(cfg, "127.0.0.1:1")
+
+	ts.Req(func(conn *Conn) (interface{}, error) { return nil, errors.New("timeout") })
+	ts.Req(func(conn *Conn) (interface{}, error) { return nil, &Econnrefused{s: "refused"} })
+
+	retries := buf.records("Request retries")
+	if assert.Len(t, retries, 1) {
+		r := retries[0]
+		assert.Equal(t, "DEBUG", r["level"])
+		assert.Equal(t, "127.0.0.1:1", r[LogNode])
+		assert.Equal(t, 1.0, r[LogAttempt])
+		assert.Equal(t, 1.0, r[LogMaxRetries])
+		assert.Equal(t, "other", r[LogErrorClass])
+		assert.Equal(t, "timeout", r[LogError])
+		assert.Contains(t, r, LogDuration)
+	}
+
+	closes := buf.records("Close connection to cluster")
+	if assert.Len(t, closes, 1) {
+		assert.Equal(t, "WARN", closes[0]["level"])
+		assert.Equal(t, "connection", closes[0][LogErrorClass])
+	}
+
+	// Records under the level are dropped.
+	buf = &syncBuffer{}
+	ts.Configure(func(cfg *Config) *Config {
+		cfg.Slog = slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+		return cfg
+	})
+	ts.Req(func(conn *Conn) (interface{}, error) { return nil, errors.New("timeout") })
+	assert.Empty(t, buf.records("Request retries"))
+}
+
+func TestLoggerHandler(t *testing.T) {
+	var lines []string
+	printf := func(format string, params ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, params...))
+	}
+
+	logger := slog.New(NewLoggerHandler(printf, slog.LevelInfo))
+	logger.Debug("dropped")
+	logger.With(LogNode, "127.0.0.1:1").WithGroup("req").Info("Request retries %d", LogAttempt, 2,
+		slog.Group("err", LogErrorClass, ErrorOther))
+	assert.Equal(t, []string{"Request retries %d node=127.0.0.1:1 req.attempt=2 req.err.error_class=other"}, lines)
+
+	// The old Logger is used at all of levels when Slog isn't set.
+	lines = nil
+	cfg := NewConfig()
+	cfg.Logger = printf
+	cfg.log().Debug("Request retries", LogAttempt, 1)
+	assert.Equal(t, []string{"Request retries attempt=1"}, lines)
+}
@@ -0,0 +1,133 @@
+package clustertransport
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ErrorClass is a class of errors which are returned by requests.
+type ErrorClass string
+
+// Classes of errors, which determine how Transport handles them.
+const (
+	ErrorNone       ErrorClass = ""           // Succeeded
+	ErrorRedirect   ErrorClass = "redirect"   // Redirect, which is retried on the node
+	ErrorConnection ErrorClass = "connection" // Connection errors, which mark the node as dead
+	ErrorOther      ErrorClass = "other"      // Any other errors, which are retried
+)
+
+// Classify returns the class of err as Transport handles it, which looks
+// into wrapped errors as well.
+func Classify(err error) ErrorClass {
+	var (
+		redirect *Redirect
+		ue       *url.Error
+		oe       *net.OpError
+		se       *os.SyscallError
+		ce       *Econnrefused
+	)
+
+	switch {
+	case err == nil:
+		return ErrorNone
+	case errors.As(err, &redirect):
+		return ErrorRedirect
+	case errors.As(err, &ue), errors.As(err, &oe), errors.As(err, &se), errors.As(err, &ce),
+		errors.Is(err, driver.ErrBadConn):
+		return ErrorConnection
+	default:
+		return ErrorOther
+	}
+}
+
+// MetricsSink records metrics of Transport. Methods are called on the
+// goroutine which handles requests, so that they shouldn't block.
+type MetricsSink interface {
+	// Request records an attempt of the request to the node.
+	Request(uri string, latency time.Duration, class ErrorClass)
+	// Retry records that the request which failed on the node is retried.
+	Retry(uri string, class ErrorClass)
+	// NodeDead records that the node was marked as dead.
+	NodeDead(uri string)
+	// NodeAlive records that the dead node was resurrected or marked as alive.
+	NodeAlive(uri string)
+	// Discovery records a discovery of kind, such as "refresh", "reload",
+	// "discover" and "push".
+	Discovery(kind string, duration time.Duration, err error)
+	// QueueDepth records requests which are waiting for the transport.
+	QueueDepth(depth int)
+	// Nodes records nodes which were added into connections, as alive ones,
+	// and nodes which were removed from connections.
+	Nodes(added, removed []string)
+}
+
+// NopMetrics records nothing.
+type NopMetrics struct{}
+
+// Request does nothing.
+func (NopMetrics) Request(uri string, latency time.Duration, class ErrorClass) {}
+
+// Retry does nothing.
+func (NopMetrics) Retry(uri string, class ErrorClass) {}
+
+// NodeDead does nothing.
+func (NopMetrics) NodeDead(uri string) {}
+
+// NodeAlive does nothing.
+func (NopMetrics) NodeAlive(uri string) {}
+
+// Discovery does nothing.
+func (NopMetrics) Discovery(kind string, duration time.Duration, err error) {}
+
+// QueueDepth does nothing.
+func (NopMetrics) QueueDepth(depth int) {}
+
+// Nodes does nothing.
+func (NopMetrics) Nodes(added, removed []string) {}
+
+// metrics returns Config.Metrics, which is NopMetrics when it isn't set.
+func (cfg *Config) metrics() MetricsSink {
+	if cfg.Metrics == nil {
+		return NopMetrics{}
+	}
+	return cfg.Metrics
+}
+
+// diffURIs returns uris which are only in after, and which are only in before.
+func diffURIs(before, after []string) (added, removed []string) {
+	seen := make(map[string]bool, len(before))
+	for _, uri := range before {
+		seen[uri] = true
+	}
+	for _, uri := range after {
+		if !seen[uri] {
+			added = append(added, uri)
+		}
+		delete(seen, uri)
+	}
+	for _, uri := range before {
+		if seen[uri] {
+			removed = append(removed, uri)
+		}
+	}
+
+	return added, removed
+}
+
+func (k sniffKind) String() string {
+	switch k {
+	case sniffRefresh:
+		return "refresh"
+	case sniffReload:
+		return "reload"
+	case sniffDiscover:
+		return "discover"
+	case sniffPush:
+		return "push"
+	}
+	return "unknown"
+}
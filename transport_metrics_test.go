@@ -0,0 +1,105 @@
+package clustertransport
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordMetrics struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (m *recordMetrics) record(ev string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, ev)
+}
+
+func (m *recordMetrics) Request(uri string, latency time.Duration, class ErrorClass) {
+	m.record("request " + uri + " " + string(class))
+}
+func (m *recordMetrics) Retry(uri string, class ErrorClass) {
+	m.record("retry " + uri + " " + string(class))
+}
+func (m *recordMetrics) NodeDead(uri string)  { m.record("dead " + uri) }
+func (m *recordMetrics) NodeAlive(uri string) { m.record("alive " + uri) }
+func (m *recordMetrics) QueueDepth(depth int) {}
+func (m *recordMetrics) Nodes(added, removed []string) {
+	m.record(fmt.Sprintf("nodes %v %v", added, removed))
+}
+func (m *recordMetrics) Discovery(kind string, duration time.Duration, err error) {
+	m.record("discovery " + kind)
+}
+
+func (m *recordMetrics) take() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := m.events
+	m.events = nil
+	return events
+}
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, ErrorNone, Classify(nil))
+	assert.Equal(t, ErrorRedirect, Classify(&Redirect{URI: "a:1"}))
+	assert.Equal(t, ErrorConnection, Classify(&net.OpError{Err: errors.New("refused")}))
+	assert.Equal(t, ErrorConnection, Classify(&Econnrefused{s: "refused"}))
+	assert.Equal(t, ErrorOther, Classify(errors.New("timeout")))
+
+	// Wrapped errors are classified by their causes.
+	assert.Equal(t, ErrorConnection, Classify(fmt.Errorf("query: %w", driver.ErrBadConn)))
+	assert.Equal(t, ErrorConnection, Classify(fmt.Errorf("get: %w", &net.OpError{Err: errors.New("refused")})))
+	assert.Equal(t, ErrorConnection, Classify(NewEconnrefused(errors.New("refused"))))
+	assert.Equal(t, ErrorRedirect, Classify(fmt.Errorf("moved: %w", &Redirect{URI: "a:1"})))
+}
+
+func TestMetrics(t *testing.T) {
+	m := &recordMetrics{}
+
+	cfg := NewConfig()
+	cfg.Cluster = &stubCluster{sniffed: []string{"127.0.0.1:1"}}
+	cfg.Metrics = m
+	cfg.DiscoverOnFailure = false
+	cfg.DiscoverRatio = 0
+	cfg.MaxRetries = 1
+	ts := NewTransport(cfg, "127.0.0.1:1")
+	assert.NoError(t, ts.Discover(context.Background()))
+	events := m.take()
+	if assert.True(t, len(events) >= 2, events) {
+		assert.Equal(t, "nodes [127.0.0.1:1] []", events[0])
+		assert.Regexp(t, "^discovery (reload|discover)$", events[1])
+	}
+
+	ts.Req(func(conn *Conn) (interface{}, error) { return nil, nil })
+	assert.Equal(t, []string{"request 127.0.0.1:1 "}, m.take())
+
+	ts.Req(func(conn *Conn) (interface{}, error) { return nil, errors.New("timeout") })
+	assert.Equal(t, []string{
+		"request 127.0.0.1:1 other",
+		"retry 127.0.0.1:1 other",
+		"request 127.0.0.1:1 other",
+	}, m.take())
+
+	ts.Req(func(conn *Conn) (interface{}, error) { return nil, &Econnrefused{s: "refused"} })
+	assert.Equal(t, []string{"request 127.0.0.1:1 connection", "dead 127.0.0.1:1"}, m.take())
+
+	// The last dead node is resurrected.
+	ts.Req(func(conn *Conn) (interface{}, error) { return nil, nil })
+	assert.Equal(t, []string{"alive 127.0.0.1:1", "request 127.0.0.1:1 "}, m.take())
+
+	ts.MarkDead("127.0.0.1:1")
+	ts.MarkAlive("127.0.0.1:1")
+	assert.Equal(t, []string{"dead 127.0.0.1:1", "alive 127.0.0.1:1"}, m.take())
+
+	ts.SetNodes("127.0.0.1:2", "127.0.0.1:3")
+	assert.Equal(t, []string{"nodes [127.0.0.1:2 127.0.0.1:3] [127.0.0.1:1]", "discovery push"}, m.take())
+}
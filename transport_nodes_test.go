@@ -0,0 +1,445 @@
+package clustertransport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCluster struct {
+	sniffed []string
+	delay   time.Duration
+}
+
+func (c *stubCluster) Sniff(conn *Conn) []string {
+	time.Sleep(c.delay)
+	return c.sniffed
+}
+
+func (c *stubCluster) Conn(uri string) (*Conn, error) { return &Conn{}, nil }
+
+func newStubTransport(uris ...string) *Transport {
+	cfg := NewConfig()
+	cfg.Cluster = &stubCluster{}
+	return NewTransport(cfg, uris...)
+}
+
+// testURIs reads connections on the goroutine which handles requests.
+func (t *Transport) testURIs() []string {
+	item, _ := t.Req(func(conn *Conn) (interface{}, error) {
+		return t.conns.uris(), nil
+	})
+	return item.([]string)
+}
+
+// waitURIs waits for connections to be swapped in by background discovery.
+func waitURIs(t *testing.T, ts *Transport, want []string) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if assert.ObjectsAreEqual(want, ts.testURIs()) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, want, ts.testURIs())
+}
+
+func TestNodes(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1")
+
+	ts.AddNode("127.0.0.1:2")
+	ts.AddNode("127.0.0.1:2")
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, ts.testURIs())
+
+	ts.RemoveNode("127.0.0.1:1")
+	assert.Equal(t, []string{"127.0.0.1:2"}, ts.testURIs())
+
+	ts.RemoveNode("127.0.0.1:2")
+	assert.Equal(t, []string{"127.0.0.1:2"}, ts.testURIs(), "the last node should be kept")
+
+	ts.SetNodes("127.0.0.1:3", "127.0.0.1:4")
+	assert.Equal(t, []string{"127.0.0.1:3", "127.0.0.1:4"}, ts.testURIs())
+}
+
+type stubWatcher struct {
+	events []NodeEvent
+}
+
+func (w *stubWatcher) Watch(ctx context.Context, events chan<- NodeEvent) error {
+	for _, ev := range w.events {
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWatch(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1")
+
+	w := &stubWatcher{events: []NodeEvent{
+		{Type: NodesSet, URIs: []string{"127.0.0.1:2", "127.0.0.1:3"}},
+		{Type: NodeAdded, URIs: []string{"127.0.0.1:4"}},
+		{Type: NodeRemoved, URIs: []string{"127.0.0.1:2"}},
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, ts.Watch(ctx, w))
+	assert.Equal(t, []string{"127.0.0.1:3", "127.0.0.1:4"}, ts.testURIs())
+}
+
+// blindWatcher sends events without watching ctx after sending is started.
+type blindWatcher struct{ start, returned chan struct{} }
+
+func (w *blindWatcher) Watch(ctx context.Context, events chan<- NodeEvent) error {
+	defer close(w.returned)
+
+	<-w.start
+	for i := 0; i < 3; i++ {
+		events <- NodeEvent{Type: NodeAdded, URIs: []string{"127.0.0.1:2"}}
+	}
+	return nil
+}
+
+func TestWatchDrains(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1")
+	w := &blindWatcher{start: make(chan struct{}), returned: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, ts.Watch(ctx, w))
+	close(w.start)
+
+	// Events after ctx is done are dropped, and the watcher isn't blocked.
+	select {
+	case <-w.returned:
+	case <-time.After(time.Second):
+		t.Fatal("watcher is blocked")
+	}
+	assert.Equal(t, []string{"127.0.0.1:1"}, ts.testURIs())
+}
+
+func TestDiscover(t *testing.T) {
+	cfg := NewConfig()
+	cluster := &stubCluster{}
+	cfg.Cluster = cluster
+	ts := NewTransport(cfg, "127.0.0.1:1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.Error(t, ts.Discover(ctx), "nothing should be discovered")
+	assert.Equal(t, []string{"127.0.0.1:1"}, ts.testURIs())
+
+	// Changes cluster state on the goroutine which handles requests.
+	ts.Configure(func(cfg *Config) *Config {
+		cluster.sniffed = []string{"127.0.0.1:1", "127.0.0.1:2"}
+		return cfg
+	})
+
+	assert.NoError(t, ts.Discover(ctx))
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, ts.testURIs())
+}
+
+func TestDiscoverAfterReload(t *testing.T) {
+	m := &recordMetrics{}
+
+	cfg := NewConfig()
+	cfg.Cluster = &stubCluster{sniffed: []string{"127.0.0.1:1"}, delay: 50 * time.Millisecond}
+	cfg.Metrics = m
+	ts := NewTransport(cfg, "127.0.0.1:1")
+
+	// Discover isn't answered by reloading which is running since launched.
+	assert.NoError(t, ts.Discover(context.Background()))
+	assert.Contains(t, m.take(), "discovery discover")
+}
+
+func TestDiscoverOnFailure(t *testing.T) {
+	cfg := NewConfig()
+	cluster := &stubCluster{sniffed: []string{"127.0.0.1:2"}}
+	cfg.Cluster = cluster
+	cfg.DiscoverTick = 3600
+
+	// NewTransport would discover nodes as soon as launched.
+	ts := &Transport{
+		cfg:           cfg,
+		logger:        cfg.log(),
+		request:       make(chan *container, 100),
+		configure:     make(chan struct{ fun func(*Config) *Config }),
+		discover:      make(chan *discoverRequest),
+		discovered:    make(chan *sniffResult),
+		lastRequestAt: time.Now(),
+	}
+	ts.conns = ts.newConns(buildConns(newSniffConfig(cfg), nil, []string{"127.0.0.1:1"}))
+	ts.sniffer = newSniffer(cfg, ts.conns, ts.discovered)
+	go ts.run()
+
+	_, err := ts.Req(func(conn *Conn) (interface{}, error) {
+		return nil, &Econnrefused{s: "refused"}
+	})
+	assert.Error(t, err)
+
+	waitURIs(t, ts, []string{"127.0.0.1:2"})
+}
+
+func TestDiscoverOffRequestPath(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Cluster = &stubCluster{sniffed: []string{"127.0.0.1:2"}, delay: 300 * time.Millisecond}
+	ts := NewTransport(cfg, "127.0.0.1:1")
+
+	began := time.Now()
+	assert.Equal(t, []string{"127.0.0.1:1"}, ts.testURIs())
+	assert.True(t, time.Since(began) < 100*time.Millisecond, "request waited for discovery")
+
+	waitURIs(t, ts, []string{"127.0.0.1:2"})
+}
+
+func TestSniffTimeout(t *testing.T) {
+	sc := newSniffConfig(NewConfig())
+	sc.cluster = &stubCluster{sniffed: []string{"127.0.0.1:2"}, delay: 200 * time.Millisecond}
+	sc.sniffTimeout = 10 * time.Millisecond
+
+	assert.Empty(t, sc.sniff(&Conn{URI: "127.0.0.1:1"}))
+
+	sc.sniffTimeout = time.Second
+	assert.Equal(t, []string{"127.0.0.1:2"}, sc.sniff(&Conn{URI: "127.0.0.1:1"}))
+}
+
+func TestConfigureResetsTicker(t *testing.T) {
+	cfg := NewConfig()
+	cluster := &stubCluster{}
+	cfg.Cluster = cluster
+	cfg.DiscoverTick = 3600
+	ts := NewTransport(cfg, "127.0.0.1:1")
+	assert.Error(t, ts.Discover(context.Background()))
+
+	ts.Configure(func(cfg *Config) *Config {
+		cluster.sniffed = []string{"127.0.0.1:2"}
+		cfg.DiscoverTick = 1
+		return cfg
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if assert.ObjectsAreEqual([]string{"127.0.0.1:2"}, ts.testURIs()) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(t, []string{"127.0.0.1:2"}, ts.testURIs())
+}
+
+func TestMarkDead(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1", "127.0.0.1:2")
+	ts.Configure(func(cfg *Config) *Config {
+		cfg.DiscoverOnFailure = false
+		cfg.DiscoverRatio = 0
+		return cfg
+	})
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, ts.Nodes())
+
+	assert.True(t, ts.MarkDead("127.0.0.1:1"))
+	assert.False(t, ts.MarkDead("127.0.0.1:3"))
+
+	for i := 0; i < 3; i++ {
+		uri, _ := ts.Req(func(conn *Conn) (interface{}, error) { return conn.URI, nil })
+		assert.Equal(t, "127.0.0.1:2", uri)
+	}
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, ts.Nodes(), "dead nodes should be kept")
+
+	assert.True(t, ts.MarkAlive("127.0.0.1:1"))
+	seen := map[interface{}]bool{}
+	for i := 0; i < 2; i++ {
+		uri, _ := ts.Req(func(conn *Conn) (interface{}, error) { return conn.URI, nil })
+		seen[uri] = true
+	}
+	assert.Len(t, seen, 2)
+}
+
+func TestDrain(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1", "127.0.0.1:2")
+
+	assert.True(t, ts.Drain("127.0.0.1:1"))
+	assert.False(t, ts.Drain("127.0.0.1:3"))
+
+	// Drained nodes are kept over discovery.
+	ts.AddNode("127.0.0.1:3")
+	for i := 0; i < 4; i++ {
+		uri, _ := ts.Req(func(conn *Conn) (interface{}, error) { return conn.URI, nil })
+		assert.NotEqual(t, "127.0.0.1:1", uri)
+	}
+	assert.Equal(t, 1, ts.Snapshot().Drained)
+
+	assert.True(t, ts.Undrain("127.0.0.1:1"))
+	seen := map[interface{}]bool{}
+	for i := 0; i < 3; i++ {
+		uri, _ := ts.Req(func(conn *Conn) (interface{}, error) { return conn.URI, nil })
+		seen[uri] = true
+	}
+	assert.Len(t, seen, 3)
+}
+
+func TestDrainDead(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1")
+	ts.Configure(func(cfg *Config) *Config {
+		cfg.DiscoverOnFailure = false
+		cfg.DiscoverRatio = 0
+		return cfg
+	})
+
+	// A drained dead node is never resurrected.
+	assert.True(t, ts.MarkDead("127.0.0.1:1"))
+	assert.True(t, ts.Drain("127.0.0.1:1"))
+	_, err := ts.Req(func(conn *Conn) (interface{}, error) { return conn.URI, nil })
+	assert.Error(t, err)
+
+	ts.AddNode("127.0.0.1:2")
+	uri, err := ts.Req(func(conn *Conn) (interface{}, error) { return conn.URI, nil })
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:2", uri)
+
+	// Rebuilt connections which are all drained are swapped in.
+	assert.True(t, ts.Drain("127.0.0.1:2"))
+	ts.RemoveNode("127.0.0.1:1")
+	assert.Equal(t, []string{"127.0.0.1:2"}, ts.Nodes())
+}
+
+func TestRedirectDrained(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1", "127.0.0.1:2")
+	assert.True(t, ts.Drain("127.0.0.1:2"))
+
+	// The drained node which redirection points is skipped for the selector.
+	var uris []string
+	ts.Req(func(conn *Conn) (interface{}, error) {
+		uris = append(uris, conn.URI)
+		if len(uris) <= 1 {
+			return nil, &Redirect{URI: "127.0.0.1:2", Err: errors.New("MOVED")}
+		}
+		return nil, nil
+	})
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:1"}, uris)
+}
+
+func TestSniffTarget(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Cluster = &stubCluster{sniffed: []string{"127.0.0.1:1", "127.0.0.1:2"}}
+	cfg.DiscoverOnFailure = false
+	cfg.DiscoverRatio = 0
+	ts := NewTransport(cfg, "127.0.0.1:1", "127.0.0.1:2")
+	assert.NoError(t, ts.Discover(context.Background()))
+
+	// Sniffing doesn't advance the selector.
+	uri := func() interface{} {
+		item, _ := ts.Req(func(conn *Conn) (interface{}, error) { return conn.URI, nil })
+		return item
+	}
+	first := uri()
+	assert.NoError(t, ts.Discover(context.Background()))
+	assert.NotEqual(t, first, uri())
+
+	// Sniffing doesn't resurrect dead nodes.
+	ts.MarkDead("127.0.0.1:1")
+	ts.MarkDead("127.0.0.1:2")
+	assert.NoError(t, ts.Discover(context.Background()))
+	assert.Equal(t, 2, ts.Snapshot().Deads)
+}
+
+func TestRejectedRebuild(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1", "127.0.0.1:2")
+	ts.Configure(func(cfg *Config) *Config {
+		cfg.DiscoverOnFailure = false
+		cfg.DiscoverRatio = 0
+		return cfg
+	})
+
+	// There's no alive node after removing, so that it's rejected.
+	ts.MarkDead("127.0.0.1:1")
+	ts.RemoveNode("127.0.0.1:2")
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, ts.Nodes())
+
+	ts.AddNode("127.0.0.1:3")
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"}, ts.Nodes())
+}
+
+func TestUnchangedNodes(t *testing.T) {
+	cfg := NewConfig()
+	tracer := &recordTracer{}
+	cfg.Tracer = tracer
+	cfg.Cluster = &stubCluster{sniffed: []string{"127.0.0.1:2", "127.0.0.1:1"}}
+	ts := NewTransport(cfg, "127.0.0.1:1", "127.0.0.1:2")
+
+	var before, after []*Conn
+	ts.do(func() { before = ts.conns.all() })
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, ts.Discover(context.Background()))
+	}
+
+	assert.Empty(t, tracer.find(SpanRebuild), "unchanged nodes shouldn't be rebuilt")
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, ts.Nodes())
+	ts.do(func() { after = ts.conns.all() })
+	if assert.Len(t, after, len(before)) {
+		for i := range before {
+			assert.Same(t, before[i], after[i], "connections should be kept as they are")
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	nodes := ts.Notify(ctx)
+	assert.Equal(t, []string{"127.0.0.1:1"}, <-nodes)
+
+	// Nodes which haven't been received are replaced by the latest ones.
+	ts.AddNode("127.0.0.1:2")
+	ts.AddNode("127.0.0.1:3")
+	assert.Equal(t, []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"}, <-nodes)
+
+	cancel()
+	for range nodes {
+	}
+}
+
+type slowClient struct{ closed chan struct{} }
+
+func (c *slowClient) Close() error {
+	close(c.closed)
+	return nil
+}
+
+type slowCluster struct {
+	stubCluster
+	client *slowClient
+}
+
+func (c *slowCluster) Conn(uri string) (*Conn, error) {
+	time.Sleep(50 * time.Millisecond)
+	return &Conn{Client: c.client}, nil
+}
+
+func TestDialTimeoutClosesLateConn(t *testing.T) {
+	client := &slowClient{closed: make(chan struct{})}
+
+	sc := newSniffConfig(NewConfig())
+	sc.cluster = &slowCluster{client: client}
+	sc.dialTimeout = 10 * time.Millisecond
+
+	_, err := sc.conn("127.0.0.1:1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	select {
+	case <-client.closed:
+	case <-time.After(time.Second):
+		t.Error("the late connection should be closed")
+	}
+}
@@ -30,3 +30,59 @@ func (rr *RoundRobinSelector) Select(conns []*Conn) *Conn {
 
 	return conn
 }
+
+// WeightedRandomSelector selects connections in random order which is
+// weighted by Conn.Weight. A connection has weight 1 when it's zero.
+type WeightedRandomSelector struct{}
+
+// Select is
+func (ws *WeightedRandomSelector) Select(conns []*Conn) *Conn {
+	total := 0
+	for _, conn := range conns {
+		total += connWeight(conn)
+	}
+
+	n := rand.Intn(total)
+	for _, conn := range conns {
+		if n -= connWeight(conn); n < 0 {
+			return conn
+		}
+	}
+
+	return conns[len(conns)-1]
+}
+
+func connWeight(conn *Conn) int {
+	if conn.Weight <= 0 {
+		return 1
+	}
+	return conn.Weight
+}
+
+// LabelSelector selects connections which have the label in preference to
+// others, or connections which don't have it when Avoid is true. All of
+// connections are candidates when there's no preferred one.
+type LabelSelector struct {
+	Key      string
+	Value    string
+	Avoid    bool
+	Selector SelectorBase // Default: RoundRobinSelector
+}
+
+// Select is
+func (ls *LabelSelector) Select(conns []*Conn) *Conn {
+	preferred := make([]*Conn, 0, len(conns))
+	for _, conn := range conns {
+		if (conn.Labels[ls.Key] == ls.Value) != ls.Avoid {
+			preferred = append(preferred, conn)
+		}
+	}
+	if len(preferred) <= 0 {
+		preferred = conns
+	}
+
+	if ls.Selector == nil {
+		ls.Selector = &RoundRobinSelector{}
+	}
+	return ls.Selector.Select(preferred)
+}
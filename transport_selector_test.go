@@ -0,0 +1,37 @@
+package clustertransport
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedRandomSelector(t *testing.T) {
+	conns := []*Conn{{URI: "a", Weight: 0}, {URI: "b", Weight: 3}}
+
+	counts := map[string]int{}
+	s := &WeightedRandomSelector{}
+	for i := 0; i < 4000; i++ {
+		counts[s.Select(conns).URI]++
+	}
+
+	assert.InDelta(t, 1000, counts["a"], 200)
+	assert.InDelta(t, 3000, counts["b"], 200)
+}
+
+func TestLabelSelector(t *testing.T) {
+	leader := &Conn{URI: "a", Labels: map[string]string{"role": "leader"}}
+	follower1 := &Conn{URI: "b", Labels: map[string]string{"role": "follower"}}
+	follower2 := &Conn{URI: "c"}
+	conns := []*Conn{leader, follower1, follower2}
+
+	prefer := &LabelSelector{Key: "role", Value: "leader"}
+	assert.Equal(t, leader, prefer.Select(conns))
+	assert.Equal(t, leader, prefer.Select(conns))
+	assert.Equal(t, follower1, prefer.Select([]*Conn{follower1}), "falls back to others")
+
+	avoid := &LabelSelector{Key: "role", Value: "leader", Avoid: true}
+	assert.Equal(t, follower1, avoid.Select(conns))
+	assert.Equal(t, follower2, avoid.Select(conns))
+	assert.Equal(t, leader, avoid.Select([]*Conn{leader}), "falls back to others")
+}
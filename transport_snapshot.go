@@ -0,0 +1,179 @@
+package clustertransport
+
+import (
+	"fmt"
+	"time"
+)
+
+// Snapshot is an immutable view of Transport, which is taken at once on the
+// goroutine that handles requests.
+type Snapshot struct {
+	At            time.Time         `json:"at"`
+	Nodes         []NodeSnapshot    `json:"nodes"`
+	Alives        int               `json:"alives"`
+	Deads         int               `json:"deads"`
+	Drained       int               `json:"drained"`
+	Pending       int               `json:"pending"` // Requests which are waiting for the transport
+	Counter       int64             `json:"counter"` // Requests since connections were swapped in
+	LastRequestAt time.Time         `json:"lastRequestAt"`
+	Discovery     DiscoverySnapshot `json:"discovery"`
+	Config        ConfigSnapshot    `json:"config"`
+}
+
+// NodeSnapshot is a state of the node.
+type NodeSnapshot struct {
+	URI       string            `json:"uri"`
+	Dead      bool              `json:"dead"`
+	Drained   bool              `json:"drained"`
+	Failures  int64             `json:"failures"`
+	DeadSince time.Time         `json:"deadSince"` // Zero when the node has never been dead
+	Weight    int               `json:"weight"`
+	Labels    map[string]string `json:"labels"`
+	InFlight  int64             `json:"inFlight"` // Attempts of Acquire which aren't ended, since Req never overlaps a snapshot
+	Requests  int64             `json:"requests"`
+	Errors    int64             `json:"errors"`
+	Latency   LatencySnapshot   `json:"latency"`
+}
+
+// LatencySnapshot is latency statistics of requests to the node.
+type LatencySnapshot struct {
+	Mean time.Duration `json:"mean"`
+	Min  time.Duration `json:"min"`
+	Max  time.Duration `json:"max"`
+	Last time.Duration `json:"last"`
+}
+
+// DiscoverySnapshot is a state of discovery.
+type DiscoverySnapshot struct {
+	Discovering bool      `json:"discovering"`
+	Waits       int       `json:"waits"` // Callers of Discover which are waiting
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	Error       string    `json:"error,omitempty"` // The last discovery's error
+}
+
+// ConfigSnapshot is a copy of Config, which holds type names instead of
+// Cluster and Selector.
+type ConfigSnapshot struct {
+	Cluster           string  `json:"cluster"`
+	Selector          string  `json:"selector"`
+	Discover          bool    `json:"discover"`
+	DiscoverTick      int     `json:"discoverTick"`
+	DiscoverAfter     int64   `json:"discoverAfter"`
+	DiscoverOnFailure bool    `json:"discoverOnFailure"`
+	DiscoverRatio     float64 `json:"discoverRatio"`
+	DiscoverInterval  int     `json:"discoverInterval"`
+	SniffTick         int     `json:"sniffTick"`
+	SniffTimeout      int     `json:"sniffTimeout"`
+	DialTimeout       int     `json:"dialTimeout"`
+	RetryOnFailure    bool    `json:"retryOnFailure"`
+	ResurrectAfter    int64   `json:"resurrectAfter"`
+	MaxRetries        int     `json:"maxRetries"`
+	Debug             bool    `json:"debug"`
+	DebugTick         int     `json:"debugTick"`
+}
+
+// Snapshot returns a consistent view of nodes, discovery and configuration.
+func (t *Transport) Snapshot() *Snapshot {
+	var s *Snapshot
+	t.do(func() {
+		s = t.snapshot()
+	})
+
+	return s
+}
+
+func (t *Transport) snapshot() *Snapshot {
+	s := &Snapshot{
+		At:            time.Now(),
+		Nodes:         make([]NodeSnapshot, 0, len(t.conns.all())),
+		Pending:       len(t.request),
+		Counter:       t.counter,
+		LastRequestAt: t.lastRequestAt,
+		Discovery: DiscoverySnapshot{
+			Discovering: t.discovering,
+			Waits:       len(t.discoverWaits),
+			StartedAt:   t.lastDiscoverAt,
+			FinishedAt:  t.lastDiscoveredAt,
+		},
+		Config: newConfigSnapshot(t.cfg),
+	}
+
+	if t.lastDiscoverErr != nil {
+		s.Discovery.Error = t.lastDiscoverErr.Error()
+	}
+
+	for _, conn := range t.conns.all() {
+		s.Nodes = append(s.Nodes, conn.snapshot())
+		switch {
+		case conn.isDead():
+			s.Deads++
+		case conn.drained:
+			s.Drained++
+		default:
+			s.Alives++
+		}
+	}
+
+	return s
+}
+
+func (c *Conn) snapshot() NodeSnapshot {
+	n := NodeSnapshot{
+		URI:       c.URI,
+		Dead:      c.Dead,
+		Drained:   c.drained,
+		Failures:  c.Failures,
+		DeadSince: c.deadSince,
+		Weight:    c.Weight,
+		InFlight:  c.stats.inFlight,
+		Requests:  c.stats.requests,
+		Errors:    c.stats.errors,
+		Latency: LatencySnapshot{
+			Min:  c.stats.min,
+			Max:  c.stats.max,
+			Last: c.stats.last,
+		},
+	}
+
+	if c.stats.requests > 0 {
+		n.Latency.Mean = c.stats.latency / time.Duration(c.stats.requests)
+	}
+
+	if c.Labels != nil {
+		n.Labels = make(map[string]string, len(c.Labels))
+		for k, v := range c.Labels {
+			n.Labels[k] = v
+		}
+	}
+
+	return n
+}
+
+func newConfigSnapshot(cfg *Config) ConfigSnapshot {
+	return ConfigSnapshot{
+		Cluster:           typeName(cfg.Cluster),
+		Selector:          typeName(cfg.Selector),
+		Discover:          cfg.Discover,
+		DiscoverTick:      cfg.DiscoverTick,
+		DiscoverAfter:     cfg.DiscoverAfter,
+		DiscoverOnFailure: cfg.DiscoverOnFailure,
+		DiscoverRatio:     cfg.DiscoverRatio,
+		DiscoverInterval:  cfg.DiscoverInterval,
+		SniffTick:         cfg.SniffTick,
+		SniffTimeout:      cfg.SniffTimeout,
+		DialTimeout:       cfg.DialTimeout,
+		RetryOnFailure:    cfg.RetryOnFailure,
+		ResurrectAfter:    cfg.ResurrectAfter,
+		MaxRetries:        cfg.MaxRetries,
+		Debug:             cfg.Debug,
+		DebugTick:         cfg.DebugTick,
+	}
+}
+
+func typeName(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,65 @@
+package clustertransport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Cluster = &stubCluster{sniffed: []string{"127.0.0.1:1", "127.0.0.1:2"}}
+	cfg.Selector = &LabelSelector{Key: "zone", Value: "a"}
+	cfg.DiscoverOnFailure = false
+	cfg.DiscoverRatio = 0
+	ts := NewTransport(cfg, "127.0.0.1:1", "127.0.0.1:2")
+	assert.NoError(t, ts.Discover(context.Background()))
+
+	ts.Req(func(conn *Conn) (interface{}, error) {
+		time.Sleep(time.Millisecond)
+		return nil, errors.New("retried")
+	})
+	ts.Req(func(conn *Conn) (interface{}, error) {
+		return nil, &net.OpError{Op: "dial", Err: errors.New("refused")}
+	})
+
+	s := ts.Snapshot()
+	assert.Equal(t, 2, len(s.Nodes))
+	assert.Equal(t, 1, s.Alives)
+	assert.Equal(t, 1, s.Deads)
+	assert.False(t, s.Discovery.Discovering)
+	assert.False(t, s.Discovery.FinishedAt.IsZero())
+	assert.Equal(t, "*clustertransport.LabelSelector", s.Config.Selector)
+	assert.Equal(t, "*clustertransport.stubCluster", s.Config.Cluster)
+
+	var requests, errs int64
+	for _, n := range s.Nodes {
+		requests += n.Requests
+		errs += n.Errors
+		assert.Equal(t, int64(0), n.InFlight)
+		assert.True(t, n.Latency.Min <= n.Latency.Mean && n.Latency.Mean <= n.Latency.Max)
+
+		if n.Dead {
+			assert.Equal(t, int64(1), n.Failures)
+			assert.False(t, n.DeadSince.IsZero())
+		}
+	}
+	assert.Equal(t, int64(cfg.MaxRetries+2), requests)
+	assert.Equal(t, requests, errs)
+
+	// Snapshot is a copy which isn't changed by the transport.
+	uri := s.Nodes[0].URI
+	assert.True(t, ts.MarkAlive(s.Nodes[1].URI))
+	assert.True(t, ts.MarkDead(uri))
+	assert.Equal(t, uri, s.Nodes[0].URI)
+	assert.Equal(t, 1, s.Deads)
+	assert.Equal(t, 1, ts.Snapshot().Deads)
+
+	_, err := json.Marshal(s)
+	assert.NoError(t, err)
+}
@@ -1,10 +1,12 @@
 package clustertransport
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
 	"github.com/ikeikeikeike/memdtest"
@@ -88,6 +90,66 @@ func TestUnnested(t *testing.T) {
 	}
 }
 
+func TestReqContextDone(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1")
+
+	// The request waits behind the request which is running.
+	running, release := make(chan struct{}), make(chan struct{})
+	go ts.Req(func(conn *Conn) (interface{}, error) {
+		close(running)
+		<-release
+		return nil, nil
+	})
+	<-running
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	called := false
+	_, err := ts.ReqContext(ctx, func(conn *Conn) (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	close(release)
+
+	// The request which was given up isn't run.
+	item, err := ts.Req(func(conn *Conn) (interface{}, error) {
+		return called, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, false, item)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = ts.ReqKeyContext(ctx, "key", func(conn *Conn) (interface{}, error) {
+		return nil, nil
+	})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestClose(t *testing.T) {
+	ts := newStubTransport("127.0.0.1:1")
+	ts.Close()
+	ts.Close()
+
+	_, err := ts.Req(func(conn *Conn) (interface{}, error) { return nil, nil })
+	assert.Equal(t, errClosed, err)
+	_, err = ts.Acquire(context.Background(), "")
+	assert.Equal(t, errClosed, err)
+	assert.Equal(t, errClosed, ts.Discover(context.Background()))
+	assert.Nil(t, ts.Snapshot())
+
+	// Membership changes don't wait for the closed transport.
+	ts.SetNodes("127.0.0.1:2")
+}
+
+func TestAddr(t *testing.T) {
+	assert.Equal(t, "10.0.0.1:11211", Addr("10.0.0.1:11211"))
+	assert.Equal(t, "10.0.0.1:9200", Addr("http://10.0.0.1:9200/"))
+	assert.Equal(t, "10.0.0.1:50051", Addr("grpc://10.0.0.1:50051/svc?x=1"))
+}
+
 type nproxy struct {
 	ts  *Transport
 	get func(...interface{}) (interface{}, error)
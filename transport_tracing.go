@@ -0,0 +1,57 @@
+package clustertransport
+
+import "context"
+
+// Names of spans which are started by Transport.
+const (
+	SpanRequest   = "clustertransport.request"      // A request through Req, which contains attempts
+	SpanAttempt   = "clustertransport.attempt"      // An attempt of the request to the node
+	SpanDiscovery = "clustertransport.discovery"    // A discovery, which contains sniffing and rebuilding
+	SpanSniff     = "clustertransport.sniff"        // Sniffing cluster system via the node
+	SpanRebuild   = "clustertransport.rebuildConns" // Establishing connections to discovered nodes
+)
+
+// Keys of span attributes.
+const (
+	AttrNode       = "clustertransport.node"        // Uri of the node
+	AttrRetry      = "clustertransport.retry"       // Retry number of the attempt, which starts from 0
+	AttrErrorClass = "clustertransport.error_class" // ErrorClass
+	AttrKey        = "clustertransport.key"         // Key of ReqKey
+	AttrKind       = "clustertransport.kind"        // Kind of the discovery
+	AttrNodes      = "clustertransport.nodes"       // Number of nodes which were sniffed or connected
+)
+
+// Tracer starts spans of requests and discoveries. Spans of requests are
+// started on the goroutine which handles requests, so that it shouldn't block.
+type Tracer interface {
+	// Start starts a span of name as a child of the span in ctx.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span which is started by Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	// End ends the span, which is marked as failed when err isn't nil.
+	End(err error)
+}
+
+// NopTracer traces nothing.
+type NopTracer struct{}
+
+// Start returns ctx as it is and a span which does nothing.
+func (NopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key string, value interface{}) {}
+func (nopSpan) End(err error)                              {}
+
+// tracer returns Config.Tracer, which is NopTracer when it isn't set.
+func (cfg *Config) tracer() Tracer {
+	if cfg.Tracer == nil {
+		return NopTracer{}
+	}
+	return cfg.Tracer
+}
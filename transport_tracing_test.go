@@ -0,0 +1,114 @@
+package clustertransport
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+type recordSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	err    error
+}
+
+type recordTracer struct {
+	mu    sync.Mutex
+	spans []*recordSpan // Ended spans
+}
+
+func (tr *recordTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &recordSpan{name: name, attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(string); ok {
+		s.parent = parent
+	}
+	return context.WithValue(ctx, spanKey{}, name), &recordEnd{tr: tr, span: s}
+}
+
+func (tr *recordTracer) find(name string) []*recordSpan {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	var spans []*recordSpan
+	for _, s := range tr.spans {
+		if s.name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+type recordEnd struct {
+	tr   *recordTracer
+	span *recordSpan
+}
+
+func (e *recordEnd) SetAttribute(key string, value interface{}) { e.span.attrs[key] = value }
+func (e *recordEnd) End(err error) {
+	e.span.err = err
+	e.tr.mu.Lock()
+	e.tr.spans = append(e.tr.spans, e.span)
+	e.tr.mu.Unlock()
+}
+
+func TestTracing(t *testing.T) {
+	tr := &recordTracer{}
+
+	cfg := NewConfig()
+	cfg.Cluster = &stubCluster{sniffed: []string{"127.0.0.1:1", "127.0.0.1:2"}}
+	cfg.Tracer = tr
+	cfg.Discover = false
+	cfg.MaxRetries = 1
+	ts := NewTransport(cfg, "127.0.0.1:1")
+
+	// The first one may join the discovery which is started by NewTransport.
+	ctx := context.WithValue(context.Background(), spanKey{}, "caller")
+	assert.NoError(t, ts.Discover(ctx))
+	assert.NoError(t, ts.Discover(ctx))
+
+	discovery := tr.find(SpanDiscovery)
+	if assert.NotEmpty(t, discovery) {
+		last := discovery[len(discovery)-1]
+		assert.Equal(t, "caller", last.parent)
+		assert.Equal(t, "discover", last.attrs[AttrKind])
+	}
+	if sniffs := tr.find(SpanSniff); assert.NotEmpty(t, sniffs) {
+		assert.Equal(t, SpanDiscovery, sniffs[0].parent)
+		assert.Equal(t, 2, sniffs[0].attrs[AttrNodes])
+	}
+	if rebuilds := tr.find(SpanRebuild); assert.Len(t, rebuilds, 1) {
+		assert.Equal(t, SpanDiscovery, rebuilds[0].parent)
+	}
+
+	var attemptCtx context.Context
+	_, err := ts.ReqKeyContext(ctx, "k", func(ctx context.Context, conn *Conn) (interface{}, error) {
+		attemptCtx = ctx
+		return nil, errors.New("timeout")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, SpanAttempt, attemptCtx.Value(spanKey{}))
+
+	reqs := tr.find(SpanRequest)
+	if assert.Len(t, reqs, 1) {
+		assert.Equal(t, "caller", reqs[0].parent)
+		assert.Equal(t, "k", reqs[0].attrs[AttrKey])
+		assert.Equal(t, "other", reqs[0].attrs[AttrErrorClass])
+		assert.Error(t, reqs[0].err)
+	}
+
+	attempts := tr.find(SpanAttempt)
+	if assert.Len(t, attempts, 2) {
+		for i, s := range attempts {
+			assert.Equal(t, SpanRequest, s.parent)
+			assert.Equal(t, i, s.attrs[AttrRetry])
+			assert.Contains(t, []string{"127.0.0.1:1", "127.0.0.1:2"}, s.attrs[AttrNode])
+			assert.Equal(t, "other", s.attrs[AttrErrorClass])
+		}
+	}
+}